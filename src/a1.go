@@ -0,0 +1,140 @@
+package broadlinkrm
+
+import (
+	"context"
+	"fmt"
+)
+
+// LightLevel is the ambient light reported by an A1.
+type LightLevel int
+
+// Enumerations of LightLevel.
+const (
+	LightDark LightLevel = iota
+	LightDim
+	LightNormal
+	LightBright
+)
+
+func (l LightLevel) String() string {
+	switch l {
+	case LightDark:
+		return "dark"
+	case LightDim:
+		return "dim"
+	case LightNormal:
+		return "normal"
+	case LightBright:
+		return "bright"
+	}
+	return "unknown"
+}
+
+// AirQuality is the air quality reported by an A1.
+type AirQuality int
+
+// Enumerations of AirQuality.
+const (
+	AirExcellent AirQuality = iota
+	AirGood
+	AirNormal
+	AirBad
+)
+
+func (a AirQuality) String() string {
+	switch a {
+	case AirExcellent:
+		return "excellent"
+	case AirGood:
+		return "good"
+	case AirNormal:
+		return "normal"
+	case AirBad:
+		return "bad"
+	}
+	return "unknown"
+}
+
+// NoiseLevel is the ambient noise reported by an A1.
+type NoiseLevel int
+
+// Enumerations of NoiseLevel.
+const (
+	NoiseQuiet NoiseLevel = iota
+	NoiseNormal
+	NoiseNoisy
+)
+
+func (n NoiseLevel) String() string {
+	switch n {
+	case NoiseQuiet:
+		return "quiet"
+	case NoiseNormal:
+		return "normal"
+	case NoiseNoisy:
+		return "noisy"
+	}
+	return "unknown"
+}
+
+// SensorReadings holds the readings of an A1 environmental sensor.
+type SensorReadings struct {
+	Temperature float64 // degrees Celsius
+	Humidity    float64 // relative humidity in percent
+	Light       LightLevel
+	AirQuality  AirQuality
+	Noise       NoiseLevel
+}
+
+// GetSensors returns the readings of an A1 environmental sensor. If id is an
+// empty string it selects the first device.
+func (b *Broadlink) GetSensors(id string) (SensorReadings, error) {
+	return b.GetSensorsContext(context.Background(), id)
+}
+
+// GetSensorsContext is like GetSensors but gives up as soon as ctx is done.
+func (b *Broadlink) GetSensorsContext(ctx context.Context, id string) (SensorReadings, error) {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return SensorReadings{}, err
+	}
+	if !isKnownDevice(d.deviceType).sensors {
+		return SensorReadings{}, unsupportedf("device %v is of device type %v (0x%04x) and is not an environmental sensor", d.mac.String(), d.deviceType, d.deviceType)
+	}
+	if err := d.acquire(ctx); err != nil {
+		return SensorReadings{}, err
+	}
+	defer d.release()
+
+	return d.readSensors(ctx)
+}
+
+// readSensors queries an A1. Temperature and humidity are reported as an
+// integer part followed by tenths, and the other readings as levels.
+func (d *device) readSensors(ctx context.Context) (SensorReadings, error) {
+	resp, err := d.serverRequest(ctx, readSensorsPayload())
+	if err != nil {
+		return SensorReadings{}, fmt.Errorf("error while making server request to read sensors: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return SensorReadings{}, resp.deviceError()
+	}
+	if resp.Type != CommandOK || len(resp.Data) < 9 {
+		return SensorReadings{}, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
+	}
+	data := resp.Data
+	return SensorReadings{
+		Temperature: float64(data[0]) + float64(data[1])/10,
+		Humidity:    float64(data[2]) + float64(data[3])/10,
+		Light:       LightLevel(data[4]),
+		AirQuality:  AirQuality(data[6]),
+		Noise:       NoiseLevel(data[8]),
+	}, nil
+}
+
+func readSensorsPayload() unencryptedRequest {
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: basicRequestPayload(0x01),
+	}
+}
@@ -1,72 +1,163 @@
 package broadlinkrm
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const defaultTimeout = 5 // seconds
 
-// Broadlink keeps a track of all the devices and sockets.
+// Broadlink keeps a track of all the devices and sockets. It is safe for
+// concurrent use and should be shared by pointer. Requests to the same device
+// are serialized.
 type Broadlink struct {
-	timeout int // in seconds
-	devices []*device
-	lookup  map[string]*device
+	mu        sync.RWMutex
+	timeout   int // in seconds
+	transport Transport
+	devices   []*device
+	lookup    map[string]*device
+
+	credentialsCallback func(Credentials)
+
+	eventsMu    sync.Mutex
+	subscribers map[chan Event]struct{}
 }
 
-// NewBroadlink creates and initializes a new Broadlink struct.
-func NewBroadlink() Broadlink {
-	b := Broadlink{
-		timeout: defaultTimeout,
-		lookup:  make(map[string]*device),
+// NewBroadlink creates and initializes a new Broadlink struct that talks to
+// devices over UDP port 80.
+func NewBroadlink() *Broadlink {
+	return NewBroadlinkWithTransport(UDPTransport{})
+}
+
+// NewBroadlinkWithTransport creates and initializes a new Broadlink struct that
+// uses the specified Transport for discovery and for talking to devices.
+func NewBroadlinkWithTransport(t Transport) *Broadlink {
+	b := &Broadlink{
+		timeout:   defaultTimeout,
+		transport: t,
+		lookup:    make(map[string]*device),
 	}
 	return b
 }
 
 // WithTimeout sets the timeout for all subsequent read operations.
 func (b *Broadlink) WithTimeout(t int) *Broadlink {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.timeout = t
 	return b
 }
 
 // Count returns the number of devices that were discovered.
-func (b Broadlink) Count() int {
+func (b *Broadlink) Count() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return len(b.devices)
 }
 
 // Discover will populate the Broadlink struct with a slice of Devices.
 func (b *Broadlink) Discover() error {
-	conn, err := net.ListenPacket("udp4", "")
+	return b.DiscoverContext(context.Background())
+}
+
+// DiscoverContext is like Discover but stops listening for responses as soon
+// as ctx is done.
+func (b *Broadlink) DiscoverContext(ctx context.Context) error {
+	return b.DiscoverWithOptions(ctx, DiscoverOptions{})
+}
+
+// DiscoverWithOptions is like DiscoverContext but lets you choose the
+// interfaces, broadcast addresses and unicast targets that discovery packets
+// are sent to.
+func (b *Broadlink) DiscoverWithOptions(ctx context.Context, opts DiscoverOptions) error {
+	return b.DiscoverStream(ctx, opts, nil)
+}
+
+// DiscoverStream is like DiscoverWithOptions but calls fn as soon as each
+// device responds, including devices that are unknown, unsupported, or that
+// fail to authenticate. A device that answers more than one discovery packet
+// is only reported once. Devices are authenticated concurrently, but calls to
+// fn are serialized. fn may be nil.
+//
+// Responses are collected until ctx is done. Devices that respond are given
+// their own timeout to authenticate, so a device that responds just before
+// ctx's deadline is still added. nil is returned if the deadline of ctx ends
+// the search, and ctx's error is returned if ctx is cancelled.
+func (b *Broadlink) DiscoverStream(ctx context.Context, opts DiscoverOptions, fn func(DiscoveryResult)) error {
+	dests, err := opts.destinations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := b.transport.ListenPacket()
 	if err != nil {
 		return fmt.Errorf("could not bind UDP listener: %v", err)
 	}
 	defer conn.Close()
 
 	log.Printf("Listening to address %v", conn.LocalAddr().String())
-	err = sendBroadcastPacket(conn)
+	err = sendDiscoveryPackets(conn, b.transport, dests)
 	if err != nil {
-		return fmt.Errorf("error sending broadcast packet: %v", err)
-	}
-	b.readPacket(conn)
+		return fmt.Errorf("error sending discovery packets: %v", err)
+	}
+	var wg sync.WaitGroup
+	var fnLock sync.Mutex
+	seen := make(map[string]bool)
+	b.readPacket(ctx, conn, func(hello helloResponse) {
+		mac := hello.mac.String()
+		if seen[mac] {
+			return
+		}
+		seen[mac] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			authCtx, cancel := context.WithTimeout(context.Background(), time.Duration(b.deviceTimeout()*sendRetries)*time.Second)
+			defer cancel()
+			result := b.addDevice(authCtx, hello)
+			if fn != nil {
+				fnLock.Lock()
+				fn(result)
+				fnLock.Unlock()
+			}
+		}()
+	})
+	wg.Wait()
 
-	return nil
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return ctx.Err()
 }
 
 // Learn sends a learn command to the specified device. If id is an empty string it selects the first device.
 func (b *Broadlink) Learn(id string) (string, error) {
+	return b.LearnContext(context.Background(), id)
+}
+
+// LearnContext is like Learn but takes the device out of learning mode and
+// returns as soon as ctx is done.
+func (b *Broadlink) LearnContext(ctx context.Context, id string) (string, error) {
 	d, err := b.deviceIsCapableOfIR(id)
 	if err != nil {
 		return "", err
 	}
+	if err := d.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer d.release()
 
-	resp, err := d.learn()
+	resp, err := d.learn(ctx)
 	if err != nil {
-		return "", fmt.Errorf("error while calling learn: %v", err)
+		return "", fmt.Errorf("error while calling learn: %w", err)
 	}
 
 	log.Print("Learn successful")
@@ -75,14 +166,24 @@ func (b *Broadlink) Learn(id string) (string, error) {
 
 // LearnRF sends an RF Sweep command to the specified device. If id is an empty string it selects the first device.
 func (b *Broadlink) LearnRF(id string) (string, error) {
+	return b.LearnRFContext(context.Background(), id)
+}
+
+// LearnRFContext is like LearnRF but takes the device out of learning mode and
+// returns as soon as ctx is done.
+func (b *Broadlink) LearnRFContext(ctx context.Context, id string) (string, error) {
 	d, err := b.deviceIsCapableOfRF(id)
 	if err != nil {
 		return "", err
 	}
+	if err := d.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer d.release()
 
-	resp, err := d.learnRF()
+	resp, err := d.learnRF(ctx)
 	if err != nil {
-		return "", fmt.Errorf("error while calling learn RF: %v", err)
+		return "", fmt.Errorf("error while calling learn RF: %w", err)
 	}
 
 	log.Print("Learn RF successful")
@@ -90,53 +191,203 @@ func (b *Broadlink) LearnRF(id string) (string, error) {
 }
 
 // Execute looks at the device type and decides if it should call send() or
-// setPowerState().
+// setPowerState(). Outlets of a power strip are addressed with data in the
+// form OUTLET:STATE, e.g. 3:1 turns on the third outlet.
 func (b *Broadlink) Execute(id, s string) error {
+	return b.ExecuteContext(context.Background(), id, s)
+}
+
+// ExecuteContext is like Execute but gives up as soon as ctx is done.
+func (b *Broadlink) ExecuteContext(ctx context.Context, id, s string) error {
 	d, err := b.deviceExistsAndIsKnown(id)
 	if err != nil {
 		return err
 	}
+	if err := d.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.release()
+
 	devChar := isKnownDevice(d.deviceType)
+	if devChar.outlets > 0 {
+		outlet, state, err := parseOutletData(s)
+		if err != nil {
+			return fmt.Errorf("device %v is a power strip: %v", d.mac.String(), err)
+		}
+		return d.setOutletPower(ctx, outlet, state)
+	}
 	if devChar.power {
 		l := len(s)
 		if l != 1 && l != 2 {
 			return fmt.Errorf("device %v is a power outlet and can only accept the data of 0, 00, 1, or 01 - got %v instead", d.mac.String(), s)
 		}
-		return d.setPowerState(s)
+		return d.setPowerState(ctx, s)
 	}
 	if devChar.ir || devChar.rf {
-		return d.sendString(s)
+		return d.sendString(ctx, s)
 	}
-	return fmt.Errorf("device %v device type %v (0x%04x) is not capable of power control, IR, and RF", d.mac.String(), d.deviceType, d.deviceType)
+	return unsupportedf("device %v device type %v (0x%04x) is not capable of power control, IR, and RF", d.mac.String(), d.deviceType, d.deviceType)
 }
 
 // GetPowerState queries a WiFi-enabled power outlet and returns its state (on or off).
 func (b *Broadlink) GetPowerState(id string) (bool, error) {
+	return b.GetPowerStateContext(context.Background(), id)
+}
+
+// GetPowerStateContext is like GetPowerState but gives up as soon as ctx is
+// done.
+func (b *Broadlink) GetPowerStateContext(ctx context.Context, id string) (bool, error) {
 	d, err := b.deviceIsCapableOfPowerControl(id)
 	if err != nil {
 		return false, err
 	}
-	return d.getPowerState()
+	if isKnownDevice(d.deviceType).outlets > 0 {
+		return false, unsupportedf("device %v is a power strip - query the state of an outlet instead", d.mac.String())
+	}
+	if err := d.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer d.release()
+
+	return d.getPowerState(ctx)
+}
+
+// GetNightlight returns the state of the nightlight of an SP3. If id is an
+// empty string it selects the first device.
+func (b *Broadlink) GetNightlight(id string) (bool, error) {
+	return b.GetNightlightContext(context.Background(), id)
+}
+
+// GetNightlightContext is like GetNightlight but gives up as soon as ctx is
+// done.
+func (b *Broadlink) GetNightlightContext(ctx context.Context, id string) (bool, error) {
+	d, err := b.deviceHasNightlight(id)
+	if err != nil {
+		return false, err
+	}
+	if err := d.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer d.release()
+
+	_, nightlight, err := d.getState(ctx)
+	return nightlight, err
+}
+
+// SetNightlight turns the nightlight of an SP3 on or off. The state of the
+// outlet is left unchanged. If id is an empty string it selects the first
+// device.
+func (b *Broadlink) SetNightlight(id string, state bool) error {
+	return b.SetNightlightContext(context.Background(), id, state)
+}
+
+// SetNightlightContext is like SetNightlight but gives up as soon as ctx is
+// done.
+func (b *Broadlink) SetNightlightContext(ctx context.Context, id string, state bool) error {
+	d, err := b.deviceHasNightlight(id)
+	if err != nil {
+		return err
+	}
+	if err := d.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.release()
+
+	return d.setNightlight(ctx, state)
+}
+
+// GetEnergy returns the power in watts drawn through an SP3S. If id is an
+// empty string it selects the first device.
+func (b *Broadlink) GetEnergy(id string) (float64, error) {
+	return b.GetEnergyContext(context.Background(), id)
+}
+
+// GetEnergyContext is like GetEnergy but gives up as soon as ctx is done.
+func (b *Broadlink) GetEnergyContext(ctx context.Context, id string) (float64, error) {
+	d, err := b.deviceIsCapableOfPowerControl(id)
+	if err != nil {
+		return 0, err
+	}
+	if !isKnownDevice(d.deviceType).energy {
+		return 0, unsupportedf("device %v is of device type %v (0x%04x) and is not capable of energy metering", d.mac.String(), d.deviceType, d.deviceType)
+	}
+	if err := d.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer d.release()
+
+	return d.getEnergy(ctx)
+}
+
+// GetTemperature returns the temperature in degrees Celsius measured by the
+// built-in sensor of an RM device. If id is an empty string it selects the
+// first device.
+func (b *Broadlink) GetTemperature(id string) (float64, error) {
+	return b.GetTemperatureContext(context.Background(), id)
+}
+
+// GetTemperatureContext is like GetTemperature but gives up as soon as ctx is
+// done.
+func (b *Broadlink) GetTemperatureContext(ctx context.Context, id string) (float64, error) {
+	d, err := b.deviceIsCapableOfIR(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := d.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer d.release()
+
+	return d.checkTemperature(ctx)
+}
+
+// GetHumidity returns the relative humidity in percent measured by the sensor
+// of an RM4 device. If id is an empty string it selects the first device.
+func (b *Broadlink) GetHumidity(id string) (float64, error) {
+	return b.GetHumidityContext(context.Background(), id)
+}
+
+// GetHumidityContext is like GetHumidity but gives up as soon as ctx is done.
+func (b *Broadlink) GetHumidityContext(ctx context.Context, id string) (float64, error) {
+	d, err := b.deviceIsCapableOfIR(id)
+	if err != nil {
+		return 0, err
+	}
+	if d.family() != familyRM4 {
+		return 0, unsupportedf("device %v is of device type %v (0x%04x) and does not have a humidity sensor", d.mac.String(), d.deviceType, d.deviceType)
+	}
+	if err := d.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer d.release()
+
+	_, humidity, err := d.checkSensors(ctx)
+	return humidity, err
 }
 
 // AddManualDevice adds a device manually - bypassing the authentication phase.
 func (b *Broadlink) AddManualDevice(ip, mac, key, id string, deviceType int) error {
 	devChar := isKnownDevice(deviceType)
 	if !devChar.supported {
-		return fmt.Errorf("device type %v (0x%04x) is not supported", deviceType, deviceType)
+		return unsupportedf("device type %v (0x%04x) is not supported", deviceType, deviceType)
 	}
-	d, err := newManualDevice(ip, mac, key, id, b.timeout, deviceType)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, err := newManualDevice(b.transport, ip, mac, key, id, b.timeout, deviceType)
 	if err != nil {
 		return err
 	}
-	if b.getDevice(d.remoteAddr) != nil {
+	if b.lookup[strings.ToLower(d.remoteAddr)] != nil {
 		log.Printf("A device with IP %v already exists - skipping manual add", d.remoteAddr)
 		return nil
 	}
 	hw := d.mac.String()
-	if (len(hw) > 0) && (b.getDevice(hw) != nil) {
+	if (len(hw) > 0) && (b.lookup[strings.ToLower(hw)] != nil) {
 		log.Printf("A device with MAC %v already exists - skipping manual add", hw)
+		return nil
 	}
+	b.watchHealth(d)
+	b.watchCredentials(d)
 	b.devices = append(b.devices, d)
 	b.lookup[d.remoteAddr] = d
 	if len(hw) > 0 {
@@ -146,7 +397,54 @@ func (b *Broadlink) AddManualDevice(ip, mac, key, id string, deviceType int) err
 	return nil
 }
 
-func (b Broadlink) getDevice(id string) *device {
+// Variants of devices that share a device type.
+const (
+	VariantHysen = "hysen"
+	VariantDooya = "dooya"
+)
+
+// SetVariant tells the library which kind of device it is talking to when a
+// device type is shared by several products. Device type 0x4e4d is used by
+// both the Hysen heating controller (VariantHysen) and the Dooya curtain motor
+// (VariantDooya).
+func (b *Broadlink) SetVariant(id, variant string) error {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return err
+	}
+	if isKnownDevice(d.deviceType).family != familyHysenOrDooya {
+		return unsupportedf("device %v is of device type %v (0x%04x), which does not have variants", d.mac.String(), d.deviceType, d.deviceType)
+	}
+
+	var f deviceFamily
+	switch strings.ToLower(variant) {
+	case VariantHysen:
+		f = familyHysen
+	case VariantDooya:
+		f = familyDooya
+	default:
+		return fmt.Errorf("%v is not a valid variant - expected %v or %v", variant, VariantHysen, VariantDooya)
+	}
+
+	d.mu.Lock()
+	d.variant = f
+	d.mu.Unlock()
+	return nil
+}
+
+// Close releases the socket that is kept open for each device. Sockets are
+// reopened on demand if the devices are used again.
+func (b *Broadlink) Close() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, d := range b.devices {
+		d.close()
+	}
+}
+
+func (b *Broadlink) getDevice(id string) *device {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	d, ok := b.lookup[strings.ToLower(id)]
 	if !ok {
 		return nil
@@ -154,72 +452,169 @@ func (b Broadlink) getDevice(id string) *device {
 	return d
 }
 
-func (b *Broadlink) readPacket(conn net.PacketConn) {
+// readPacket reads discovery responses from conn until none arrive within the
+// timeout or ctx is done. Each response is passed to handle.
+func (b *Broadlink) readPacket(ctx context.Context, conn net.PacketConn, handle func(hello helloResponse)) {
 	var buf [1024]byte
-	if b.timeout <= 0 {
-		b.timeout = defaultTimeout
-	}
+	timeout := b.deviceTimeout()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
 	for {
-		conn.SetReadDeadline(time.Now().Add(time.Duration(b.timeout) * time.Second))
+		if ctx.Err() != nil {
+			break
+		}
+		deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
 		plen, remote, err := conn.ReadFrom(buf[:])
 		if err != nil {
 			e, ok := err.(net.Error)
-			if ok && e.Timeout() {
+			if (ok && e.Timeout()) || ctx.Err() != nil {
 				break
 			}
 			log.Printf("Error reading UDP packet: %v", err)
+			continue
 		}
 		log.Printf("Received packet of length %v bytes from %v", plen, remote.String())
 		if plen < 0x40 {
 			log.Print("Ignoring packet because it is too short")
-			return
+			continue
 		}
-		var mac net.HardwareAddr
-		mac = append(mac, buf[0x3f])
-		mac = append(mac, buf[0x3e])
-		mac = append(mac, buf[0x3d])
-		mac = append(mac, buf[0x3c])
-		mac = append(mac, buf[0x3b])
-		mac = append(mac, buf[0x3a])
-
-		deviceType := (int)(buf[0x34]) | ((int)(buf[0x35]) << 8)
-
-		b.addDevice(remote, mac, deviceType)
+		handle(parseHelloResponse(buf[:plen], remote))
 	}
 }
 
-func (b *Broadlink) addDevice(remote net.Addr, mac net.HardwareAddr, deviceType int) {
+// helloResponse holds the fields of a device's response to a discovery
+// packet.
+type helloResponse struct {
+	remoteAddr string
+	mac        net.HardwareAddr
+	deviceType int
+	info       deviceInfo
+}
+
+func parseHelloResponse(buf []byte, remote net.Addr) helloResponse {
 	remoteAddr := remote.String()
-	if strings.Contains(remoteAddr, ":") {
-		remoteAddr = remoteAddr[:strings.Index(remoteAddr, ":")]
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
 	}
+
+	var mac net.HardwareAddr
+	mac = append(mac, buf[0x3f])
+	mac = append(mac, buf[0x3e])
+	mac = append(mac, buf[0x3d])
+	mac = append(mac, buf[0x3c])
+	mac = append(mac, buf[0x3b])
+	mac = append(mac, buf[0x3a])
+
+	return helloResponse{
+		remoteAddr: remoteAddr,
+		mac:        mac,
+		deviceType: (int)(buf[0x34]) | ((int)(buf[0x35]) << 8),
+		info:       parseDeviceInfo(buf),
+	}
+}
+
+// addDevice authenticates a newly discovered device and adds it to the
+// registry.
+func (b *Broadlink) addDevice(ctx context.Context, hello helloResponse) DiscoveryResult {
+	remoteAddr, mac, deviceType := hello.remoteAddr, hello.mac, hello.deviceType
 	devChar := isKnownDevice(deviceType)
+	result := DiscoveryResult{
+		IP:           remoteAddr,
+		MAC:          mac.String(),
+		DeviceType:   deviceType,
+		Model:        devChar.name,
+		Known:        devChar.known,
+		Supported:    devChar.supported,
+		Capabilities: devChar.capabilities(),
+		Name:         hello.info.name,
+		Locked:       hello.info.locked,
+		Cloud:        hello.info.cloud,
+	}
 	if !devChar.known {
+		result.Model = "Unknown device"
 		log.Printf("Unknown device (0x%04x) at address %v, MAC %v", deviceType, remoteAddr, mac.String())
-		return
+		return result
 	}
 	if !devChar.supported {
 		log.Printf("Unsupported %v (0x%04x) found at address %v, MAC %v", devChar.name, deviceType, remoteAddr, mac.String())
+		return result
 	}
 
-	_, ipOK := b.lookup[strings.ToLower(remoteAddr)]
-	_, macOK := b.lookup[strings.ToLower(mac.String())]
-	if ipOK || macOK {
+	if existing := b.getDevice(mac.String()); existing != nil {
+		existing.setInfo(hello.info)
+		if existing.address() != remoteAddr {
+			b.moveDevice(ctx, existing, remoteAddr)
+			result.AlreadyKnown = true
+			return result
+		}
+	}
+	if b.knows(remoteAddr, mac) {
 		log.Printf("We already know about %v, MAC %v - skipping", remoteAddr, mac.String())
-		return
+		result.AlreadyKnown = true
+		return result
 	}
 	log.Printf("Found a supported %v, device type %d (0x%04x) at address %v, MAC %v", devChar.name, deviceType, deviceType, remoteAddr, mac.String())
-	dev, err := newDevice(remoteAddr, mac, b.timeout, deviceType)
+
+	// Authenticate without holding the lock so that other devices remain
+	// usable in the meantime.
+	dev, err := newDevice(ctx, b.transport, remoteAddr, mac, b.deviceTimeout(), deviceType)
 	if err != nil {
 		log.Printf("Error creating new device: %v", err)
-		return
+		result.Err = err
+		return result
+	}
+	dev.setInfo(hello.info)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ipOK := b.lookup[strings.ToLower(remoteAddr)]
+	_, macOK := b.lookup[strings.ToLower(mac.String())]
+	if ipOK || macOK {
+		log.Printf("%v, MAC %v was added while authenticating - skipping", remoteAddr, mac.String())
+		dev.close()
+		result.AlreadyKnown = true
+		return result
 	}
+	b.watchHealth(dev)
+	b.watchCredentials(dev)
 	b.devices = append(b.devices, dev)
 	b.lookup[strings.ToLower(remoteAddr)] = dev
 	b.lookup[strings.ToLower(mac.String())] = dev
+	result.Authenticated = true
+	return result
+}
+
+func (b *Broadlink) knows(remoteAddr string, mac net.HardwareAddr) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ipOK := b.lookup[strings.ToLower(remoteAddr)]
+	_, macOK := b.lookup[strings.ToLower(mac.String())]
+	return ipOK || macOK
 }
 
-func sendBroadcastPacket(conn net.PacketConn) error {
+func (b *Broadlink) deviceTimeout() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.timeout <= 0 {
+		return defaultTimeout
+	}
+	return b.timeout
+}
+
+// sendDiscoveryPackets sends a hello packet to each of the destination IP
+// addresses. It only fails if none of the packets could be sent.
+func sendDiscoveryPackets(conn net.PacketConn, transport Transport, dests []string) error {
 	ip, port, err := parseIPAndPort(conn.LocalAddr().String())
 	if err != nil {
 		return err
@@ -235,18 +630,34 @@ func sendBroadcastPacket(conn net.PacketConn) error {
 	checksum := calculateChecksum(packet[:])
 	copy(packet[0x20:], checksum[:])
 
-	return sendPacket(packet[:], conn, "255.255.255.255:80")
+	var lastErr error
+	sent := 0
+	for _, dest := range dests {
+		if err := sendPacket(packet[:], conn, deviceAddress(transport, dest)); err != nil {
+			log.Printf("Could not send discovery packet: %v", err)
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return lastErr
+	}
+	if len(dests) > 1 {
+		log.Printf("Sent %d discovery packets", sent)
+	}
+	return nil
 }
 
 func sendPacket(p []byte, conn net.PacketConn, dest string) error {
-	destAddr, err := net.ResolveUDPAddr("udp", "255.255.255.255:80")
+	destAddr, err := net.ResolveUDPAddr("udp", dest)
 	if err != nil {
-		return fmt.Errorf("could not resolve broadcast address: %v", err)
+		return fmt.Errorf("could not resolve address %v: %v", dest, err)
 	}
 
 	_, err = conn.WriteTo(p, destAddr)
 	if err != nil {
-		return fmt.Errorf("error while writing broadcast message: %v", err)
+		return fmt.Errorf("error while writing to %v: %v", dest, err)
 	}
 
 	return nil
@@ -330,23 +741,25 @@ func calculateChecksum(p []byte) [2]byte {
 	return [2]byte{(byte)(checksum & 0xff), (byte)(checksum >> 8)}
 }
 
-func (b Broadlink) deviceExistsAndIsKnown(id string) (*device, error) {
+func (b *Broadlink) deviceExistsAndIsKnown(id string) (*device, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	if len(b.devices) == 0 {
-		return nil, fmt.Errorf("no devices")
+		return nil, ErrNoDevices
 	}
 	var d *device
 	if len(id) == 0 {
 		d = b.devices[0]
 	} else {
-		d = b.getDevice(id)
+		d = b.lookup[strings.ToLower(id)]
 		if d == nil {
-			return nil, fmt.Errorf("%v is not a known device", id)
+			return nil, fmt.Errorf("%w %v", ErrUnknownDevice, id)
 		}
 	}
 	return d, nil
 }
 
-func (b Broadlink) deviceIsCapableOfIR(id string) (*device, error) {
+func (b *Broadlink) deviceIsCapableOfIR(id string) (*device, error) {
 	d, err := b.deviceExistsAndIsKnown(id)
 	if err != nil {
 		return nil, err
@@ -354,12 +767,12 @@ func (b Broadlink) deviceIsCapableOfIR(id string) (*device, error) {
 
 	devChar := isKnownDevice(d.deviceType)
 	if !devChar.ir {
-		return d, fmt.Errorf("device %v is of device type %v (0x%04x) and is not capable of sending and receiving IR", d.mac.String(), d.deviceType, d.deviceType)
+		return d, unsupportedf("device %v is of device type %v (0x%04x) and is not capable of sending and receiving IR", d.mac.String(), d.deviceType, d.deviceType)
 	}
 	return d, nil
 }
 
-func (b Broadlink) deviceIsCapableOfRF(id string) (*device, error) {
+func (b *Broadlink) deviceIsCapableOfRF(id string) (*device, error) {
 	d, err := b.deviceExistsAndIsKnown(id)
 	if err != nil {
 		return nil, err
@@ -367,12 +780,12 @@ func (b Broadlink) deviceIsCapableOfRF(id string) (*device, error) {
 
 	devChar := isKnownDevice(d.deviceType)
 	if !devChar.rf {
-		return d, fmt.Errorf("device %v is of device type %v (0x%04x) and is not capable of sending and receiving RF", d.mac.String(), d.deviceType, d.deviceType)
+		return d, unsupportedf("device %v is of device type %v (0x%04x) and is not capable of sending and receiving RF", d.mac.String(), d.deviceType, d.deviceType)
 	}
 	return d, nil
 }
 
-func (b Broadlink) deviceIsCapableOfPowerControl(id string) (*device, error) {
+func (b *Broadlink) deviceIsCapableOfPowerControl(id string) (*device, error) {
 	d, err := b.deviceExistsAndIsKnown(id)
 	if err != nil {
 		return nil, err
@@ -380,7 +793,20 @@ func (b Broadlink) deviceIsCapableOfPowerControl(id string) (*device, error) {
 
 	devChar := isKnownDevice(d.deviceType)
 	if !devChar.power {
-		return d, fmt.Errorf("device %v is of device type %v (0x%04x) and is not capable of power control", d.mac.String(), d.deviceType, d.deviceType)
+		return d, unsupportedf("device %v is of device type %v (0x%04x) and is not capable of power control", d.mac.String(), d.deviceType, d.deviceType)
+	}
+	return d, nil
+}
+
+func (b *Broadlink) deviceHasNightlight(id string) (*device, error) {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return nil, err
+	}
+
+	devChar := isKnownDevice(d.deviceType)
+	if !devChar.nightlight {
+		return d, unsupportedf("device %v is of device type %v (0x%04x) and does not have a nightlight", d.mac.String(), d.deviceType, d.deviceType)
 	}
 	return d, nil
 }
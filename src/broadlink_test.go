@@ -0,0 +1,129 @@
+package broadlinkrm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kwkoo/broadlinkrm/emulator"
+)
+
+const (
+	testDeviceType = 0x2787 // RM2 Pro Plus v2
+	testMAC        = "02:00:00:00:00:01"
+)
+
+var testCode = []byte{0x26, 0x00, 0x08, 0x00, 0x40, 0x20, 0x10, 0x10, 0x10, 0x40, 0x10, 0x10}
+
+// startEmulator starts an emulated RM device and returns it along with a
+// Broadlink that talks to it.
+func startEmulator(t *testing.T) (*emulator.Emulator, *Broadlink) {
+	t.Helper()
+	e, err := emulator.Start(emulator.Config{DeviceType: testDeviceType})
+	if err != nil {
+		t.Fatalf("could not start emulator: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e, NewBroadlinkWithTransport(UDPTransport{DevicePort: e.Port()})
+}
+
+// addEmulator is like startEmulator but also adds the emulated device with
+// its credentials.
+func addEmulator(t *testing.T) (*emulator.Emulator, *Broadlink) {
+	t.Helper()
+	e, b := startEmulator(t)
+	if err := b.AddManualDevice("127.0.0.1", testMAC, e.Key(), e.ID(), testDeviceType); err != nil {
+		t.Fatalf("could not add device: %v", err)
+	}
+	return e, b
+}
+
+func TestDiscover(t *testing.T) {
+	// The emulator listens on all addresses so that it answers the discovery
+	// packets sent to both targets.
+	e, err := emulator.Start(emulator.Config{Addr: "0.0.0.0:0", DeviceType: testDeviceType})
+	if err != nil {
+		t.Fatalf("could not start emulator: %v", err)
+	}
+	defer e.Close()
+	b := NewBroadlinkWithTransport(UDPTransport{DevicePort: e.Port()})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var results []DiscoveryResult
+	opts := DiscoverOptions{Targets: []string{"127.0.0.1", "127.0.0.2"}}
+	if err := b.DiscoverStream(ctx, opts, func(r DiscoveryResult) { results = append(results, r) }); err != nil {
+		t.Fatalf("DiscoverStream returned %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d discovery results, expected 1", len(results))
+	}
+	if r := results[0]; r.MAC != testMAC || r.DeviceType != testDeviceType || !r.Authenticated || r.Err != nil {
+		t.Errorf("unexpected discovery result %+v", r)
+	}
+	if b.Count() != 1 {
+		t.Errorf("got %d devices, expected 1", b.Count())
+	}
+}
+
+func TestLearn(t *testing.T) {
+	e, b := addEmulator(t)
+	e.AddLearnedCode(testCode)
+
+	code, err := b.Learn(testMAC)
+	if err != nil {
+		t.Fatalf("Learn returned %v", err)
+	}
+	if want := hex.EncodeToString(testCode); code != want {
+		t.Errorf("learned %v, expected %v", code, want)
+	}
+}
+
+func TestLearnCancelled(t *testing.T) {
+	_, b := addEmulator(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := b.LearnContext(ctx, testMAC)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("LearnContext returned %v, expected a deadline exceeded error", err)
+	}
+	if errors.Is(err, ErrLearnTimeout) {
+		t.Errorf("LearnContext returned %v, which should not match ErrLearnTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("LearnContext took %v to give up", elapsed)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	e, b := addEmulator(t)
+	if err := b.Execute(testMAC, hex.EncodeToString(testCode)); err != nil {
+		t.Fatalf("Execute returned %v", err)
+	}
+	emitted := e.Emitted()
+	if len(emitted) != 1 || !bytes.Equal(emitted[0], testCode) {
+		t.Errorf("emitted %x, expected %x", emitted, testCode)
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	e, b := addEmulator(t)
+	var changed []Credentials
+	b.OnCredentialsChange(func(c Credentials) { changed = append(changed, c) })
+	e.InjectError(-7, 1)
+
+	if err := b.Execute(testMAC, hex.EncodeToString(testCode)); err != nil {
+		t.Fatalf("Execute returned %v", err)
+	}
+	if len(e.Emitted()) != 1 {
+		t.Errorf("emitted %d codes, expected 1", len(e.Emitted()))
+	}
+	if len(changed) != 1 || changed[0].MAC != testMAC || changed[0].Key != e.Key() || changed[0].ID != e.ID() {
+		t.Errorf("credentials callback was called with %+v", changed)
+	}
+}
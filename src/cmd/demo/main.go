@@ -10,7 +10,7 @@ import (
 	"github.com/kwkoo/broadlinkrm"
 )
 
-var broadlink broadlinkrm.Broadlink
+var broadlink *broadlinkrm.Broadlink
 var code string
 
 func handler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/kwkoo/broadlinkrm/emulator"
+)
+
+func main() {
+	var addr, protocol, mac, name, key, id, codesPath, rfCodesPath string
+	var deviceType int
+	var temperature, humidity, energy float64
+	var latency, learnDelay, doorToggle time.Duration
+
+	flag.StringVar(&addr, "addr", ":80", "UDP address to listen on.")
+	flag.StringVar(&protocol, "protocol", "rm", "Command set to emulate - rm, rm4, sp2, mp1, a1, hysen, dooya, s1 or lb1.")
+	flag.IntVar(&deviceType, "type", 0x272a, "Device type to report during discovery.")
+	flag.StringVar(&mac, "mac", "02:00:00:00:00:01", "MAC address to report during discovery.")
+	flag.StringVar(&name, "name", "Emulator", "Device name to report during discovery.")
+	flag.StringVar(&key, "key", "", "Session key (32 hex characters) to hand out during authentication.")
+	flag.StringVar(&id, "id", "", "Device ID (8 hex characters) to hand out during authentication.")
+	flag.StringVar(&codesPath, "codes", "", "Path to a file with one hex IR code per line, returned in order when learning.")
+	flag.StringVar(&rfCodesPath, "rfcodes", "", "Path to a file with one hex RF code per line, returned in order when learning RF.")
+	flag.Float64Var(&temperature, "temperature", 25.5, "Temperature reported by the device.")
+	flag.Float64Var(&humidity, "humidity", 45, "Humidity reported by an RM4 or A1 device.")
+	flag.Float64Var(&energy, "energy", 0, "Power in watts reported by an SP3S.")
+	flag.DurationVar(&latency, "latency", 0, "Delay before each response is sent.")
+	flag.DurationVar(&learnDelay, "learndelay", 2*time.Second, "Delay before a learned code becomes available.")
+	flag.DurationVar(&doorToggle, "doortoggle", 10*time.Second, "Interval at which the door sensor of an S1 opens and closes. 0 keeps it closed.")
+	flag.Parse()
+
+	cfg := emulator.Config{
+		Addr:        addr,
+		DeviceType:  deviceType,
+		Name:        name,
+		Temperature: temperature,
+		Humidity:    humidity,
+		Energy:      energy,
+		Latency:     latency,
+		LearnDelay:  learnDelay,
+	}
+
+	switch strings.ToLower(protocol) {
+	case "rm":
+		cfg.Protocol = emulator.RM
+	case "rm4":
+		cfg.Protocol = emulator.RM4
+	case "sp2":
+		cfg.Protocol = emulator.SP2
+	case "mp1":
+		cfg.Protocol = emulator.MP1
+	case "a1":
+		cfg.Protocol = emulator.A1
+	case "hysen":
+		cfg.Protocol = emulator.Hysen
+	case "dooya":
+		cfg.Protocol = emulator.Dooya
+	case "s1":
+		cfg.Protocol = emulator.S1
+	case "lb1":
+		cfg.Protocol = emulator.LB1
+	default:
+		log.Fatalf("%v is not a valid protocol", protocol)
+	}
+
+	var err error
+	if cfg.MAC, err = net.ParseMAC(mac); err != nil {
+		log.Fatalf("Could not parse MAC address %v: %v", mac, err)
+	}
+	if cfg.Key, err = hex.DecodeString(key); err != nil {
+		log.Fatalf("Key %v is an invalid hex string: %v", key, err)
+	}
+	if cfg.ID, err = hex.DecodeString(id); err != nil {
+		log.Fatalf("ID %v is an invalid hex string: %v", id, err)
+	}
+
+	codes := readCodes(codesPath)
+	rfCodes := readCodes(rfCodesPath)
+
+	emu, err := emulator.Start(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range codes {
+		emu.AddLearnedCode(c)
+	}
+	for _, c := range rfCodes {
+		emu.AddLearnedRFCode(c)
+	}
+	if cfg.Protocol == emulator.S1 {
+		doorSerial := []byte{0x00, 0x00, 0x00, 0x01}
+		emu.AddAlarmSensor(0x31, "Front Door", doorSerial)
+		emu.AddAlarmSensor(0x21, "Hallway", []byte{0x00, 0x00, 0x00, 0x02})
+		if doorToggle > 0 {
+			go toggleDoor(emu, doorSerial, doorToggle)
+		}
+	}
+
+	fmt.Printf(`{"ip":"127.0.0.1","mac":"%v","key":"%v","id":"%v","type":%d}`+"\n", cfg.MAC.String(), emu.Key(), emu.ID(), deviceType)
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt)
+	<-shutdown
+
+	emu.Close()
+	log.Printf("Emitted %d codes", len(emu.Emitted()))
+}
+
+// toggleDoor opens and closes the door sensor of an emulated S1 forever.
+func toggleDoor(emu *emulator.Emulator, serial []byte, interval time.Duration) {
+	open := false
+	for range time.Tick(interval) {
+		open = !open
+		if open {
+			emu.SetAlarmSensorStatus(serial, 0x10)
+		} else {
+			emu.SetAlarmSensorStatus(serial, 0x00)
+		}
+		log.Printf("Door sensor open: %v", open)
+	}
+}
+
+func readCodes(path string) [][]byte {
+	codes := [][]byte{}
+	if len(path) == 0 {
+		return codes
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Could not open codes file %v: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		c, err := hex.DecodeString(line)
+		if err != nil {
+			log.Fatalf("Code %v is an invalid hex string: %v", line, err)
+		}
+		codes = append(codes, c)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Error reading codes file %v: %v", path, err)
+	}
+	return codes
+}
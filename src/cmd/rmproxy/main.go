@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"time"
 	_ "time/tzdata"
@@ -26,8 +27,16 @@ func main() {
 		Roomspath        string `mandatory:"true" env:"ROOMS" flag:"rooms" usage:"Path to the JSON file specifying a room configuration."`
 		Commandspath     string `mandatory:"true" env:"COMMANDS" flag:"commands" usage:"Path to the JSON file listing all remote commands."`
 		Deviceconfigpath string `env:"DEVICECONFIG" flag:"deviceconfig" usage:"Path to the JSON file specifying device configurations."`
+		Savedeviceconfig string `env:"SAVEDEVICECONFIG" flag:"savedeviceconfig" usage:"Path to a JSON file that the device configurations of all devices are merged into at startup and whenever their credentials or IP addresses change."`
 		Macrospath       string `env:"MACROS" flag:"macros" usage:"Path to the JSON file specifying macros."`
+		Triggerspath     string `env:"TRIGGERS" flag:"triggers" usage:"Path to the JSON file specifying macros to execute when alarm sensors change state."`
 		Hapath           string `env:"HOMEASSISTANT" flag:"homeassistant" usage:"Path to the JSON file specifying the connection details to the Home Assistant server."`
+		Interfaces       string `env:"DISCOVERINTERFACES" flag:"discoverinterfaces" usage:"Comma-separated list of network interfaces to broadcast discovery packets on."`
+		Broadcasts       string `env:"DISCOVERBROADCASTS" flag:"discoverbroadcasts" usage:"Comma-separated list of broadcast addresses to send discovery packets to."`
+		Targets          string `env:"DISCOVERTARGETS" flag:"discovertargets" usage:"Comma-separated list of IP addresses or CIDR ranges to probe during discovery."`
+		Healthcheck      int    `env:"HEALTHCHECK" flag:"healthcheck" default:"60" usage:"Interval in seconds between device health checks. 0 disables health checks."`
+		Rediscover       int    `env:"REDISCOVER" flag:"rediscover" usage:"Interval in seconds between background discovery runs that pick up new devices and changed IP addresses. 0 disables background discovery."`
+		Alarmpoll        int    `env:"ALARMPOLL" flag:"alarmpoll" default:"2" usage:"Interval in seconds between polls of the sensors paired with S1 alarm hubs. 0 disables polling."`
 	}{}
 
 	if err := configparser.Parse(&config); err != nil {
@@ -45,15 +54,54 @@ func main() {
 
 	rooms := initializeRooms(config.Roomspath, config.Commandspath)
 	macros := initializeMacros(config.Macrospath, rooms)
-	broadlink := initalizeBroadlink(config.Deviceconfigpath, config.Skipdiscovery)
+	triggers := initializeTriggers(config.Triggerspath, macros)
+	discoverOptions := broadlinkrm.DiscoverOptions{
+		Interfaces:     splitList(config.Interfaces),
+		BroadcastAddrs: splitList(config.Broadcasts),
+		Targets:        splitList(config.Targets),
+	}
+	broadlink := initalizeBroadlink(config.Deviceconfigpath, config.Skipdiscovery, discoverOptions)
+	deviceConfig := &deviceConfigWriter{
+		path:      config.Savedeviceconfig,
+		broadlink: broadlink,
+	}
+	deviceConfig.save()
+	broadlink.OnCredentialsChange(func(c broadlinkrm.Credentials) {
+		log.Printf("Device %v at %v was re-authenticated - its new key is %v and its new id is %v", c.MAC, c.IP, c.Key, c.ID)
+		deviceConfig.save()
+	})
 
 	// Setup signal handling.
-	shutdown := make(chan os.Signal)
+	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt)
 
 	var wg sync.WaitGroup
 
+	events, unsubscribe := broadlink.Subscribe()
+	defer unsubscribe()
+	go logEvents(events, deviceConfig)
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	if config.Rediscover > 0 {
+		broadlink.StartRediscovery(backgroundCtx, time.Duration(config.Rediscover)*time.Second, discoverOptions)
+		log.Printf("Rediscovering devices every %d seconds", config.Rediscover)
+	}
+	if config.Healthcheck > 0 {
+		broadlink.StartHealthMonitor(backgroundCtx, time.Duration(config.Healthcheck)*time.Second)
+		log.Printf("Checking device health every %d seconds", config.Healthcheck)
+	}
+	if config.Alarmpoll > 0 {
+		broadlink.StartAlarmMonitor(backgroundCtx, time.Duration(config.Alarmpoll)*time.Second)
+	}
+
 	commandChannel := make(chan rmweb.RemoteCommandMessage, sendChannelSize)
+
+	triggerEvents, unsubscribeTriggers := broadlink.Subscribe()
+	triggersDone := make(chan struct{})
+	go func() {
+		rmweb.TriggerWorker(triggerEvents, triggers, commandChannel)
+		close(triggersDone)
+	}()
 	wg.Add(1)
 	server := setupWebServer(config.Port, broadlink, config.Key, rooms, macros, haconfig, commandChannel, &wg)
 
@@ -63,6 +111,9 @@ func main() {
 	<-shutdown
 	log.Print("Interrupt signal received, initiating shutdown process...")
 	signal.Reset(os.Interrupt)
+	stopBackground()
+	unsubscribeTriggers()
+	<-triggersDone
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -71,10 +122,26 @@ func main() {
 	commandChannel <- rmweb.ShutdownMessage()
 	wg.Wait()
 	close(commandChannel)
+	broadlink.Close()
 
 	log.Print("Shutdown successful")
 }
 
+func logEvents(events <-chan broadlinkrm.Event, deviceConfig *deviceConfigWriter) {
+	for e := range events {
+		if e.Type == broadlinkrm.AddressChanged {
+			log.Printf("Device %v changed address from %v to %v", e.MAC, e.PreviousIP, e.IP)
+			deviceConfig.save()
+			continue
+		}
+		if e.Type == broadlinkrm.AlarmSensorChanged {
+			log.Printf("Sensor %v of device %v changed from %v to %v", e.Sensor.Name, e.MAC, e.PreviousState, e.Sensor.State)
+			continue
+		}
+		log.Printf("Device %v at %v: %v", e.MAC, e.IP, e.Type)
+	}
+}
+
 func initializeHomeAssistantConfig(haPath string) *rmweb.HomeAssistantConfig {
 	haFile, err := os.Open(haPath)
 	if err != nil {
@@ -137,7 +204,27 @@ func initializeMacros(macrosPath string, rooms rmweb.Rooms) map[string]rmweb.Rem
 	return macros
 }
 
-func initalizeBroadlink(deviceConfigPath string, skipDiscovery bool) broadlinkrm.Broadlink {
+func initializeTriggers(triggersPath string, macros map[string]rmweb.RemoteCommandMessage) rmweb.Triggers {
+	if len(triggersPath) == 0 {
+		log.Print("No triggers")
+		return rmweb.Triggers{}
+	}
+
+	triggersFile, err := os.Open(triggersPath)
+	if err != nil {
+		log.Fatalf("Could not open triggers JSON file %v: %v", triggersPath, err)
+	}
+	triggers, err := rmweb.IngestTriggers(triggersFile, macros)
+	triggersFile.Close()
+	if err != nil {
+		log.Fatalf("Error while processing triggers JSON: %v", err)
+	}
+
+	log.Printf("Processed %d triggers", triggers.Count())
+	return triggers
+}
+
+func initalizeBroadlink(deviceConfigPath string, skipDiscovery bool, discoverOptions broadlinkrm.DiscoverOptions) *broadlinkrm.Broadlink {
 	broadlink := broadlinkrm.NewBroadlink()
 
 	if len(deviceConfigPath) > 0 {
@@ -155,13 +242,18 @@ func initalizeBroadlink(deviceConfigPath string, skipDiscovery bool) broadlinkrm
 			if err != nil {
 				log.Fatalf("Error adding manual device configuration: %v", err)
 			}
+			if len(d.Variant) > 0 {
+				if err := broadlink.SetVariant(d.IP, d.Variant); err != nil {
+					log.Fatalf("Error setting variant of device %v: %v", d.IP, err)
+				}
+			}
 		}
 		log.Printf("Added %v devices manually", broadlink.Count())
 		return broadlink
 	}
 
 	if !skipDiscovery {
-		err := broadlink.Discover()
+		err := broadlink.DiscoverWithOptions(context.Background(), discoverOptions)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -175,7 +267,73 @@ func initalizeBroadlink(deviceConfigPath string, skipDiscovery bool) broadlinkrm
 	return broadlink
 }
 
-func setupWebServer(port int, broadlink broadlinkrm.Broadlink, key string, rooms rmweb.Rooms, macros map[string]rmweb.RemoteCommandMessage, haconfig *rmweb.HomeAssistantConfig, ch chan rmweb.RemoteCommandMessage, wg *sync.WaitGroup) *http.Server {
+// deviceConfigWriter merges the device configurations of all devices into a
+// file, so that they can be added manually the next time.
+type deviceConfigWriter struct {
+	mu        sync.Mutex
+	path      string
+	broadlink *broadlinkrm.Broadlink
+}
+
+// save does nothing if no path was given. Errors are logged.
+func (dw *deviceConfigWriter) save() {
+	if len(dw.path) == 0 {
+		return
+	}
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	existing := []rmweb.DeviceConfig{}
+	f, err := os.Open(dw.path)
+	if err == nil {
+		existing, err = rmweb.IngestDeviceConfig(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Not saving device configurations - could not read %v: %v", dw.path, err)
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Not saving device configurations - could not open %v: %v", dw.path, err)
+		return
+	}
+	merged := rmweb.MergeDeviceConfig(existing, rmweb.NewDeviceConfig(dw.broadlink.Credentials()))
+
+	// Write to a temporary file first so that the file is never left
+	// half-written.
+	tmp := dw.path + ".tmp"
+	f, err = os.Create(tmp)
+	if err != nil {
+		log.Printf("Could not create %v: %v", tmp, err)
+		return
+	}
+	err = rmweb.WriteDeviceConfig(f, merged)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dw.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("Could not save device configurations to %v: %v", dw.path, err)
+		return
+	}
+	log.Printf("Saved %d device configurations to %v", len(merged), dw.path)
+}
+
+// splitList splits a comma-separated list, discarding empty items.
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func setupWebServer(port int, broadlink *broadlinkrm.Broadlink, key string, rooms rmweb.Rooms, macros map[string]rmweb.RemoteCommandMessage, haconfig *rmweb.HomeAssistantConfig, ch chan rmweb.RemoteCommandMessage, wg *sync.WaitGroup) *http.Server {
 	proxy := rmweb.NewRMProxyWebServer(broadlink, key, rooms, macros, haconfig, ch)
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/kwkoo/broadlinkrm"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "provision":
+		provision(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %v COMMAND [OPTIONS]\n\n", name)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  provision  Send WiFi settings to a device in AP mode")
+	fmt.Fprintf(os.Stderr, "\nRun %v COMMAND -h for the options of a command.\n", name)
+	os.Exit(2)
+}
+
+func provision(args []string) {
+	var ssid, password, security, ip string
+	var port int
+
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	fs.StringVar(&ssid, "ssid", "", "SSID of the WiFi network that the device should join.")
+	fs.StringVar(&password, "password", "", "Password of the WiFi network.")
+	fs.StringVar(&security, "security", "wpa2", "Security mode of the WiFi network - none, wep, wpa1, wpa2 or wpa1/2.")
+	fs.StringVar(&ip, "ip", "", "IP address of the device. Defaults to broadcasting to 255.255.255.255.")
+	fs.IntVar(&port, "port", 80, "UDP port that the device listens on.")
+	fs.Parse(args)
+
+	if len(ssid) == 0 {
+		log.Fatal("The -ssid option is required")
+	}
+	mode, err := broadlinkrm.ParseSecurityMode(security)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if mode == broadlinkrm.SecurityNone && len(password) > 0 {
+		log.Fatal("A password was given for a network without security")
+	}
+
+	broadlink := broadlinkrm.NewBroadlinkWithTransport(broadlinkrm.UDPTransport{DevicePort: port})
+	if err := broadlink.Provision(ip, ssid, password, mode); err != nil {
+		log.Fatalf("Error provisioning device: %v", err)
+	}
+	log.Print("The device should now join the network - run discovery once this host is back on that network")
+}
@@ -0,0 +1,96 @@
+package broadlinkrm
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log"
+)
+
+// Credentials are the key and id that a device hands out during
+// authentication, along with what AddManualDevice needs to use them.
+type Credentials struct {
+	IP         string
+	MAC        string
+	Key        string // hex-encoded
+	ID         string // hex-encoded
+	DeviceType int
+	Variant    string // set if SetVariant was called
+}
+
+// Credentials returns the credentials of every device, whether it was
+// discovered or added manually.
+func (b *Broadlink) Credentials() []Credentials {
+	b.mu.RLock()
+	devices := make([]*device, len(b.devices))
+	copy(devices, b.devices)
+	b.mu.RUnlock()
+
+	resp := make([]Credentials, 0, len(devices))
+	for _, d := range devices {
+		resp = append(resp, d.credentials())
+	}
+	return resp
+}
+
+// OnCredentialsChange registers a function that is called whenever a device
+// is re-authenticated because it rejected its key and id, e.g. after a
+// factory reset. Use it to persist the new credentials of manually added
+// devices. The function is called while the device is busy, so it must not
+// make requests to the device.
+func (b *Broadlink) OnCredentialsChange(f func(Credentials)) *Broadlink {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.credentialsCallback = f
+	return b
+}
+
+// watchCredentials calls the credentials callback whenever d is
+// re-authenticated. It must be called before d is shared.
+func (b *Broadlink) watchCredentials(d *device) {
+	d.onReauthenticate = func() {
+		b.mu.RLock()
+		f := b.credentialsCallback
+		b.mu.RUnlock()
+		if f != nil {
+			f(d.credentials())
+		}
+	}
+}
+
+func (d *device) credentials() Credentials {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := Credentials{
+		IP:         d.remoteAddr,
+		MAC:        d.mac.String(),
+		Key:        hex.EncodeToString(d.key),
+		ID:         hex.EncodeToString(d.id),
+		DeviceType: d.deviceType,
+	}
+	switch d.variant {
+	case familyHysen:
+		c.Variant = VariantHysen
+	case familyDooya:
+		c.Variant = VariantDooya
+	}
+	return c
+}
+
+// reauthenticate replaces credentials that the device rejected.
+func (d *device) reauthenticate(ctx context.Context) error {
+	log.Printf("Device %v rejected its credentials - re-authenticating", d.mac.String())
+	if err := d.authenticate(ctx); err != nil {
+		return err
+	}
+	if d.onReauthenticate != nil {
+		d.onReauthenticate()
+	}
+	return nil
+}
+
+// rejectedCredentials returns true if resp is an error code that means the
+// device no longer accepts its key and id.
+func rejectedCredentials(resp Response) bool {
+	return resp.Type == DeviceError && errors.Is(resp.deviceError(), ErrAuthFailed)
+}
@@ -1,6 +1,7 @@
 package broadlinkrm
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/hex"
@@ -9,10 +10,12 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"sync"
 	"time"
 )
 
 const learnTimeout = 20 // seconds
+const learnPollInterval = 250 * time.Millisecond
 const sendRetries = 3
 
 // ResponseType denotes the type of payload.
@@ -28,63 +31,146 @@ const (
 	RawData
 	RawRFData
 	RawRFData2
+	SensorData
 )
 
 // Response represents a decrypted payload from the device.
 type Response struct {
 	Type ResponseType
 	Data []byte
+
+	// ErrorCode is set if Type is DeviceError.
+	ErrorCode int
+}
+
+func (r Response) deviceError() error {
+	return &DeviceCodeError{Code: r.ErrorCode}
 }
 
 type device struct {
-	conn       *net.PacketConn
-	remoteAddr string
+	// busy serializes operations on the device so that packets from
+	// concurrent requests never interleave.
+	busy       chan struct{}
+	transport  Transport
 	timeout    int
 	deviceType int
 	mac        net.HardwareAddr
-	count      int
-	key        []byte
 	iv         []byte
-	id         []byte
+
+	// key and id are only changed while both busy and mu are held, so
+	// holding either is enough to read them.
+	key []byte
+	id  []byte
+
+	// onHealthChange is called when the device goes online or offline.
+	onHealthChange func(online bool)
+
+	// onReauthenticate is called after the device was given new credentials
+	// because it rejected its old ones.
+	onReauthenticate func()
+
+	mu         sync.Mutex // guards the fields below
+	remoteAddr string
+	conn       net.PacketConn
+	count      int
+	pending    map[int]chan []byte
+	health     deviceHealth
+	variant    deviceFamily // overrides the family of the device type if set
+	info       deviceInfo
 }
 
 type unencryptedRequest struct {
 	command byte
 	payload []byte
+
+	// raw requests are answered with the whole decrypted payload as Data,
+	// regardless of the device family.
+	raw bool
 }
 
-func newDevice(remoteAddr string, mac net.HardwareAddr, timeout, deviceType int) (*device, error) {
+func newDevice(ctx context.Context, t Transport, remoteAddr string, mac net.HardwareAddr, timeout, deviceType int) (*device, error) {
 	rand.Seed(time.Now().Unix())
 	d := &device{
+		busy:       make(chan struct{}, 1),
+		transport:  t,
 		remoteAddr: remoteAddr,
 		timeout:    timeout,
 		deviceType: deviceType,
 		mac:        mac,
 		count:      rand.Intn(0xffff),
-		key:        []byte{0x09, 0x76, 0x28, 0x34, 0x3f, 0xe9, 0x9e, 0x23, 0x76, 0x5c, 0x15, 0x13, 0xac, 0xcf, 0x8b, 0x02},
 		iv:         []byte{0x56, 0x2e, 0x17, 0x99, 0x6d, 0x09, 0x3d, 0x28, 0xdd, 0xb3, 0xba, 0x69, 0x5a, 0x2e, 0x6f, 0x58},
-		id:         []byte{0, 0, 0, 0},
 	}
 
-	resp, err := d.serverRequest(authenticatePayload())
-	d.close()
+	if err := d.authenticate(ctx); err != nil {
+		d.close()
+		return d, err
+	}
+
+	return d, nil
+}
+
+// authenticate performs the 0x65 handshake, which gives the device a new key
+// and id. Any previous credentials are discarded first.
+func (d *device) authenticate(ctx context.Context) error {
+	d.mu.Lock()
+	d.key = []byte{0x09, 0x76, 0x28, 0x34, 0x3f, 0xe9, 0x9e, 0x23, 0x76, 0x5c, 0x15, 0x13, 0xac, 0xcf, 0x8b, 0x02}
+	d.id = []byte{0, 0, 0, 0}
+	d.mu.Unlock()
+
+	resp, err := d.exchange(ctx, authenticatePayload())
 	if err != nil {
-		return d, fmt.Errorf("error making authentication request: %v", err)
+		return fmt.Errorf("error making authentication request: %w", err)
 	}
 	if resp.Type == DeviceError {
-		return d, errors.New("device responded with an error code during authentication")
+		return fmt.Errorf("%w: %v", ErrAuthFailed, resp.deviceError())
 	}
 	if resp.Type != AuthOK {
-		return d, fmt.Errorf("did not get an affirmative response to the authenticaton request - expected %v but got %v instead", AuthOK, resp.Type)
+		return fmt.Errorf("%w: did not get an affirmative response to the authenticaton request - expected %v but got %v instead", ErrAuthFailed, AuthOK, resp.Type)
 	}
+	return nil
+}
 
-	return d, nil
+// refreshCredentials sends a read-only query to make sure that the device
+// still accepts its key and id, and re-authenticates if it doesn't. It returns
+// true if the device was re-authenticated. Devices that can't be probed are
+// left alone.
+func (d *device) refreshCredentials(ctx context.Context) (bool, error) {
+	req, ok := probePayload(d.family())
+	if !ok {
+		return false, nil
+	}
+	resp, err := d.exchange(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("error while checking credentials: %w", err)
+	}
+	if resp.Type != DeviceError {
+		return false, nil
+	}
+	if err := d.reauthenticate(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// address returns the IP address of the device.
+func (d *device) address() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.remoteAddr
+}
+
+// setAddress changes the IP address of the device, e.g. after its DHCP lease
+// has changed.
+func (d *device) setAddress(ip string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.remoteAddr = ip
 }
 
 // newManualDevice lets you create a device by specifying a key and id,
 // skipping the authentication phase. All fields aside from the mac address are
 // mandatory.
-func newManualDevice(ip, mac, key, id string, timeout, deviceType int) (*device, error) {
+func newManualDevice(t Transport, ip, mac, key, id string, timeout, deviceType int) (*device, error) {
 	parsedip := net.ParseIP(ip)
 	if parsedip.String() == "<nil>" {
 		return nil, fmt.Errorf("%v is not a valid IP address", ip)
@@ -111,6 +197,8 @@ func newManualDevice(ip, mac, key, id string, timeout, deviceType int) (*device,
 
 	rand.Seed(time.Now().Unix())
 	d := &device{
+		busy:       make(chan struct{}, 1),
+		transport:  t,
 		remoteAddr: parsedip.String(),
 		timeout:    timeout,
 		deviceType: deviceType,
@@ -126,19 +214,61 @@ func newManualDevice(ip, mac, key, id string, timeout, deviceType int) (*device,
 	return d, nil
 }
 
-// serverRequest sends a request to the device and waits for a response.
-func (d *device) serverRequest(req unencryptedRequest) (Response, error) {
+// acquire waits until no other operation is running on the device. Every
+// successful call must be followed by a call to release.
+func (d *device) acquire(ctx context.Context) error {
+	select {
+	case d.busy <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for device %v: %w", d.address(), ctx.Err())
+	}
+}
+
+// tryAcquire acquires the device if it is not busy.
+func (d *device) tryAcquire() bool {
+	select {
+	case d.busy <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *device) release() {
+	<-d.busy
+}
+
+// serverRequest is like exchange, but if the device rejects its credentials
+// it re-authenticates and sends the request once more.
+func (d *device) serverRequest(ctx context.Context, req unencryptedRequest) (Response, error) {
+	resp, err := d.exchange(ctx, req)
+	if err != nil || !rejectedCredentials(resp) {
+		return resp, err
+	}
+	if err := d.reauthenticate(ctx); err != nil {
+		return resp, err
+	}
+	return d.exchange(ctx, req)
+}
+
+// exchange sends a request to the device and waits for the response carrying
+// the same packet count. It gives up as soon as ctx is done.
+func (d *device) exchange(ctx context.Context, req unencryptedRequest) (Response, error) {
 	resp := Response{}
 
 	err := d.setupConnection()
 	if err != nil {
-		return resp, fmt.Errorf("could not setup UDP listener: %v", err)
+		return resp, fmt.Errorf("could not setup UDP listener: %w", err)
 	}
 
 	encryptedReq, err := d.encryptRequest(req)
 	if err != nil {
 		return resp, err
 	}
+	count := packetCount(encryptedReq)
+	ch := d.expectResponse(count)
+	defer d.forgetResponse(count)
 
 	retries := 0
 	for {
@@ -146,55 +276,137 @@ func (d *device) serverRequest(req unencryptedRequest) (Response, error) {
 
 		err = d.send(encryptedReq)
 		if err != nil {
-			if retries < sendRetries {
+			if retries < sendRetries && ctx.Err() == nil {
 				continue
 			}
-			return resp, fmt.Errorf("could not send packet: %v", err)
+			// A send that fails because the caller gave up says nothing
+			// about the health of the device.
+			if ctx.Err() == nil {
+				d.recordFailure()
+			}
+			return resp, fmt.Errorf("could not send packet: %w", err)
 		}
-
-		resp, err = d.readPacket()
-		if err != nil {
+		sent := time.Now()
+
+		timer := time.NewTimer(time.Duration(d.timeout) * time.Second)
+		select {
+		case packet := <-ch:
+			timer.Stop()
+			d.recordResponse(time.Since(sent))
+			return d.decodeResponse(packet, req.raw)
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, fmt.Errorf("gave up waiting for response from device %v: %w", d.address(), ctx.Err())
+		case <-timer.C:
 			if retries < sendRetries {
 				continue
 			}
-			return resp, fmt.Errorf("error while waiting for device response: %v", err)
+			d.recordFailure()
+			return resp, fmt.Errorf("error while waiting for device response: %w after %d attempts", ErrTimeout, retries)
 		}
-		return resp, nil
 	}
 }
 
+// expectResponse registers interest in the response to the packet with the
+// given count. The response is delivered on the returned channel.
+func (d *device) expectResponse(count int) chan []byte {
+	ch := make(chan []byte, 1)
+	d.mu.Lock()
+	d.pending[count] = ch
+	d.mu.Unlock()
+	return ch
+}
+
+func (d *device) forgetResponse(count int) {
+	d.mu.Lock()
+	delete(d.pending, count)
+	d.mu.Unlock()
+}
+
+// close releases the device's socket and stops its reader goroutine.
 func (d *device) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.conn != nil {
-		(*d.conn).Close()
+		d.conn.Close()
 		d.conn = nil
 	}
 }
 
+// setupConnection opens the device's long-lived socket if it isn't already
+// open, and starts a goroutine that reads responses from it.
 func (d *device) setupConnection() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.conn != nil {
 		return nil
 	}
 
-	conn, err := net.ListenPacket("udp4", "")
+	conn, err := d.transport.ListenPacket()
 	if err != nil {
 		return err
 	}
 
-	/*
-		file, _ := conn.(*net.UDPConn).File()
-		fd := file.Fd()
-		syscall.SetsockoptInt((int)(fd), syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 0)
-	*/
-
-	d.conn = &conn
+	d.conn = conn
+	if d.pending == nil {
+		d.pending = make(map[int]chan []byte)
+	}
+	go d.readLoop(conn)
 	return nil
 }
 
+// readLoop hands each packet received on conn to the request waiting for it,
+// matching them by the packet count at 0x28. Stale responses and duplicates
+// caused by retries are dropped.
+func (d *device) readLoop(conn net.PacketConn) {
+	var buf [2048]byte
+	for {
+		plen, _, err := conn.ReadFrom(buf[:])
+		if err != nil {
+			d.mu.Lock()
+			if d.conn == conn {
+				log.Printf("Error reading from device %v - closing connection: %v", d.remoteAddr, err)
+				d.conn = nil
+				conn.Close()
+			}
+			d.mu.Unlock()
+			return
+		}
+		if plen < 0x38 {
+			log.Printf("Ignoring packet of length %v from device %v because it is too short", plen, d.address())
+			continue
+		}
+		packet := make([]byte, plen)
+		copy(packet, buf[:plen])
+		count := packetCount(packet)
+
+		d.mu.Lock()
+		ch, ok := d.pending[count]
+		if ok {
+			delete(d.pending, count)
+		}
+		d.mu.Unlock()
+
+		if !ok {
+			log.Printf("Dropping stale or duplicate response with count %v from device %v", count, d.address())
+			continue
+		}
+		ch <- packet
+	}
+}
+
+func packetCount(packet []byte) int {
+	return (int)(packet[0x28]) | ((int)(packet[0x29]) << 8)
+}
+
 func (d *device) encryptRequest(req unencryptedRequest) ([]byte, error) {
 	if len(req.payload)%16 != 0 {
 		return []byte{}, fmt.Errorf("length of unencrypted request payload must be a multiple of 16 - got %d instead", len(req.payload))
 	}
+	d.mu.Lock()
 	d.count = (d.count + 1) & 0xffff
+	count := d.count
+	d.mu.Unlock()
 	header := make([]byte, 0x38, 0x38)
 	header[0x00] = 0x5a
 	header[0x01] = 0xa5
@@ -207,14 +419,16 @@ func (d *device) encryptRequest(req unencryptedRequest) ([]byte, error) {
 	header[0x24] = 0x2a
 	header[0x25] = 0x27
 	header[0x26] = req.command
-	header[0x28] = (byte)(d.count & 0xff)
-	header[0x29] = (byte)(d.count >> 8)
-	header[0x2a] = d.mac[5]
-	header[0x2b] = d.mac[4]
-	header[0x2c] = d.mac[3]
-	header[0x2d] = d.mac[2]
-	header[0x2e] = d.mac[1]
-	header[0x2f] = d.mac[0]
+	header[0x28] = (byte)(count & 0xff)
+	header[0x29] = (byte)(count >> 8)
+	if len(d.mac) == 6 {
+		header[0x2a] = d.mac[5]
+		header[0x2b] = d.mac[4]
+		header[0x2c] = d.mac[3]
+		header[0x2d] = d.mac[2]
+		header[0x2e] = d.mac[1]
+		header[0x2f] = d.mac[0]
+	}
 	header[0x30] = d.id[0]
 	header[0x31] = d.id[1]
 	header[0x32] = d.id[2]
@@ -252,37 +466,36 @@ func (d *device) encryptRequest(req unencryptedRequest) ([]byte, error) {
 	return packet, nil
 }
 
-func (d device) send(packet []byte) error {
-	if d.conn == nil {
+func (d *device) send(packet []byte) error {
+	d.mu.Lock()
+	conn := d.conn
+	remoteAddr := d.remoteAddr
+	d.mu.Unlock()
+	if conn == nil {
 		return errors.New("could not send packet because a connection does not exist")
 	}
-	destAddr, err := net.ResolveUDPAddr("udp", d.remoteAddr+":80")
+	destAddr, err := net.ResolveUDPAddr("udp", deviceAddress(d.transport, remoteAddr))
 	if err != nil {
-		return fmt.Errorf("could not resolve device address %v: %v", d.remoteAddr, err)
+		return fmt.Errorf("could not resolve device address %v: %w", remoteAddr, err)
 	}
 
-	_, err = (*d.conn).WriteTo(packet, destAddr)
+	_, err = conn.WriteTo(packet, destAddr)
 	if err != nil {
-		return fmt.Errorf("could not send packet: %v", err)
+		return fmt.Errorf("could not send packet: %w", err)
 	}
 	return nil
 }
 
-func (d *device) readPacket() (Response, error) {
-	var buf [1024]byte
+// decodeResponse decrypts and interprets a packet received from the device.
+func (d *device) decodeResponse(buf []byte, raw bool) (Response, error) {
 	processedPayload := Response{Type: Unknown}
-	if d.conn == nil {
-		return processedPayload, errors.New("a connection to the device does not exist")
-	}
-	(*d.conn).SetReadDeadline(time.Now().Add(time.Duration(d.timeout) * time.Second))
-	plen, _, err := (*d.conn).ReadFrom(buf[:])
-	if err != nil {
-		return processedPayload, fmt.Errorf("error reading UDP packet: %v", err)
-	}
-
+	plen := len(buf)
 	if plen < 0x38+16 {
 		return processedPayload, fmt.Errorf("received a packet with a length of %v which is too short", plen)
 	}
+	if (plen-0x38)%16 != 0 {
+		return processedPayload, fmt.Errorf("received an encrypted payload with a length of %v which is not a multiple of 16", plen-0x38)
+	}
 	encryptedPayload := make([]byte, plen-0x38, plen-0x38)
 	copy(encryptedPayload, buf[0x38:plen])
 
@@ -296,42 +509,63 @@ func (d *device) readPacket() (Response, error) {
 
 	command := buf[0x26]
 	if command == 0xe9 {
+		d.mu.Lock()
 		copy(d.key, payload[0x04:0x14])
 		copy(d.id, payload[:0x04])
+		d.mu.Unlock()
 		log.Printf("Device %v ready - updating to a new key %v and new id %v", d.mac.String(), hex.EncodeToString(d.key), hex.EncodeToString(d.id))
 		processedPayload.Type = AuthOK
 		return processedPayload, nil
 	}
 
 	if command == 0xee || command == 0xef {
-		param := payload[0]
-		errorCode := (int)(buf[0x22]) | ((int)(buf[0x23]) << 8)
+		errorCode := int(int16(uint16(buf[0x22]) | uint16(buf[0x23])<<8))
 		if errorCode != 0 {
 			processedPayload.Type = DeviceError
+			processedPayload.ErrorCode = errorCode
+			return processedPayload, nil
+		}
+		f := d.family()
+		if raw || f == familyHysen || f == familyDooya || f == familyLB1 {
+			// These devices use their own framing, which is decoded by the
+			// caller.
+			processedPayload.Type = CommandOK
+			processedPayload.Data = payload
+			return processedPayload, nil
+		}
+		param, data, err := d.splitPayload(payload)
+		if err != nil {
+			return processedPayload, err
+		}
+		if f == familySP || f == familyMP1 || f == familyA1 || f == familyS1 {
+			// These devices answer queries with the same command byte as a
+			// temperature check, so don't try to interpret it.
+			processedPayload.Type = CommandOK
+			processedPayload.Data = data
 			return processedPayload, nil
 		}
 		switch param {
 		case 1:
 			processedPayload.Type = Temperature
-			processedPayload.Data = []byte{(payload[0x4]*10 + payload[0x5]) / 10}
+			processedPayload.Data = data[:2]
 		case 2:
 			processedPayload.Type = CommandOK
 		case 4:
 			processedPayload.Type = RawData
-			processedPayload.Data = make([]byte, len(payload)-4, len(payload)-4)
-			copy(processedPayload.Data, payload[4:])
+			processedPayload.Data = data
 		case 26:
-			processedPayload.Data = make([]byte, len(payload)-4, len(payload)-4)
-			copy(processedPayload.Data, payload[4:])
-			if payload[0x4] == 1 {
+			processedPayload.Data = data
+			if data[0] == 1 {
 				processedPayload.Type = RawRFData
 			}
 		case 27:
-			processedPayload.Data = make([]byte, len(payload)-4, len(payload)-4)
-			copy(processedPayload.Data, payload[4:])
-			if payload[0x4] == 1 {
+			processedPayload.Data = data
+			if data[0] == 1 {
 				processedPayload.Type = RawRFData2
 			}
+		case 0x24:
+			processedPayload.Type = SensorData
+			processedPayload.Data = data
 		}
 		return processedPayload, nil
 	}
@@ -340,33 +574,58 @@ func (d *device) readPacket() (Response, error) {
 	return processedPayload, fmt.Errorf("unhandled command - %v", command)
 }
 
-func (d *device) sendString(s string) error {
+// splitPayload returns the command and the data of a decrypted response
+// payload. RM4 devices prefix the payload with its length, which is used to
+// strip the padding off the data.
+func (d *device) splitPayload(payload []byte) (byte, []byte, error) {
+	offset, end := 4, len(payload)
+	if d.family() == familyRM4 {
+		offset = 6
+		end = 2 + (int(payload[0]) | int(payload[1])<<8)
+		if end < offset || end > len(payload) {
+			return 0, nil, fmt.Errorf("received an RM4 payload with an invalid length of %v", end-2)
+		}
+	}
+	data := make([]byte, end-offset, len(payload)-offset)
+	copy(data, payload[offset:end])
+	// Short responses are zero-padded so that callers can always look at the
+	// first few bytes.
+	for len(data) < 2 {
+		data = append(data, 0)
+	}
+	return payload[offset-4], data, nil
+}
+
+func (d *device) family() deviceFamily {
+	d.mu.Lock()
+	variant := d.variant
+	d.mu.Unlock()
+	if variant != familyUnknown {
+		return variant
+	}
+	return isKnownDevice(d.deviceType).family
+}
+
+func (d *device) sendString(ctx context.Context, s string) error {
 	data, err := hex.DecodeString(s)
 	if err != nil {
 		return fmt.Errorf("error converting %v to hex: %v", s, err)
 	}
-	return d.sendData(data)
+	return d.sendData(ctx, data)
 }
 
-func (d *device) sendData(data []byte) error {
-	reqPayload := make([]byte, len(data)+4, len(data)+4)
-	reqPayload[0] = 0x02
-	reqPayload[1] = 0x00
-	reqPayload[2] = 0x00
-	reqPayload[3] = 0x00
-	copy(reqPayload[4:], data)
+func (d *device) sendData(ctx context.Context, data []byte) error {
 	req := unencryptedRequest{
 		command: 0x6a,
-		payload: reqPayload,
+		payload: rmPayload(d.family(), 0x02, data),
 	}
 
-	defer d.close()
-	resp, err := d.serverRequest(req)
+	resp, err := d.serverRequest(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error reading response while trying to send data to device: %v", err)
+		return fmt.Errorf("error reading response while trying to send data to device: %w", err)
 	}
 	if resp.Type == DeviceError {
-		return errors.New("device responded with an error code")
+		return resp.deviceError()
 	}
 	if resp.Type != CommandOK {
 		return fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
@@ -374,48 +633,51 @@ func (d *device) sendData(data []byte) error {
 	return nil
 }
 
-func (d *device) checkData() (Response, error) {
-	resp, err := d.serverRequest(checkDataPayload())
+func (d *device) checkData(ctx context.Context) (Response, error) {
+	resp, err := d.serverRequest(ctx, checkDataPayload(d.family()))
 	if err != nil {
-		return resp, fmt.Errorf("error making CheckData request: %v", err)
+		return resp, fmt.Errorf("error making CheckData request: %w", err)
 	}
 
 	return resp, nil
 }
 
-func (d *device) checkRFData() (Response, error) {
-	resp, err := d.serverRequest(checkRFDataPayload())
+func (d *device) checkRFData(ctx context.Context) (Response, error) {
+	resp, err := d.serverRequest(ctx, checkRFDataPayload(d.family()))
 	if err != nil {
-		return resp, fmt.Errorf("error making CheckRFData request: %v", err)
+		return resp, fmt.Errorf("error making CheckRFData request: %w", err)
 	}
 
 	return resp, nil
 }
 
-func (d *device) checkRFData2() (Response, error) {
-	resp, err := d.serverRequest(checkRFData2Payload())
+func (d *device) checkRFData2(ctx context.Context) (Response, error) {
+	resp, err := d.serverRequest(ctx, checkRFData2Payload(d.family()))
 	if err != nil {
-		return resp, fmt.Errorf("error making CheckRFData2 request: %v", err)
+		return resp, fmt.Errorf("error making CheckRFData2 request: %w", err)
 	}
 
 	return resp, nil
 }
 
-func (d *device) learn() (Response, error) {
-	deadline := time.Now().Add(learnTimeout * time.Second)
-	defer d.close()
-	_, err := d.serverRequest(enterLearningPayload())
+// learn puts the device into learning mode and polls it until it returns a
+// code. If ctx is done before then, learning mode is cancelled.
+func (d *device) learn(ctx context.Context) (Response, error) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, learnTimeout*time.Second)
+	defer cancel()
+	_, err := d.serverRequest(ctx, enterLearningPayload(d.family()))
 	if err != nil {
-		return Response{}, fmt.Errorf("error making learning request: %v", err)
+		return Response{}, fmt.Errorf("error making learning request: %w", err)
 	}
 
 	for {
-		if time.Now().After(deadline) {
-			d.cancelLearn()
-			return Response{}, errors.New("learning timeout")
+		pollDelay(ctx)
+		if err := d.learningDone(parent, ctx); err != nil {
+			return Response{}, err
 		}
 
-		resp, err := d.checkData()
+		resp, err := d.checkData(ctx)
 		if err != nil || resp.Type == DeviceError {
 			// If err != nil, it's probably because it's just timed out waiting
 			// for a response from check data.
@@ -433,27 +695,30 @@ func (d *device) learn() (Response, error) {
 
 // Information on the RF learning sequence can be found at:
 // https://github.com/mjg59/python-broadlink/issues/87
-func (d *device) learnRF() (Response, error) {
-	deadline := time.Now().Add(learnTimeout * time.Second)
-	defer d.close()
-	_, err := d.serverRequest(enterRFSweepPayload())
+func (d *device) learnRF(ctx context.Context) (Response, error) {
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, learnTimeout*time.Second)
+	defer cancel()
+	_, err := d.serverRequest(ctx, enterRFSweepPayload(d.family()))
 	if err != nil {
-		return Response{}, fmt.Errorf("error making learning request: %v", err)
+		return Response{}, fmt.Errorf("error making learning request: %w", err)
 	}
 	log.Print("Successfully sent RF frequency sweep command, waiting for long press...")
 
 	state := 0
 	for {
-		if time.Now().After(deadline) {
-			d.cancelLearn()
-			return Response{}, errors.New("learning timeout")
+		if state != 1 {
+			pollDelay(ctx)
+		}
+		if err := d.learningDone(parent, ctx); err != nil {
+			return Response{}, err
 		}
 
 		switch state {
 		case 0:
 			// Keep sending CheckRFData (check frequency) till we receive a
 			// valid RawRFData response.
-			resp, err := d.checkRFData()
+			resp, err := d.checkRFData(ctx)
 			if err != nil || resp.Type == DeviceError {
 				continue
 			}
@@ -463,12 +728,12 @@ func (d *device) learnRF() (Response, error) {
 			}
 		case 1:
 			// Send CheckRFData2 (find RF packet) once then proceed to next stage
-			if _, err = d.checkRFData2(); err == nil {
+			if _, err = d.checkRFData2(ctx); err == nil {
 				log.Print("Find RF packet request sent successfully, proceeding to check data...")
 				state = 2
 			}
 		case 2:
-			resp, err := d.checkData()
+			resp, err := d.checkData(ctx)
 			if err != nil || resp.Type == DeviceError {
 				// If err != nil, it's probably because it's just timed out waiting
 				// for a response from check data.
@@ -485,27 +750,92 @@ func (d *device) learnRF() (Response, error) {
 	}
 }
 
-func (d *device) checkTemperature() (Response, error) {
-	defer d.close()
-	resp, err := d.serverRequest(checkTemperaturePayload())
+// checkTemperature returns the temperature in degrees Celsius. The device
+// reports the integer part and the tenths in separate bytes.
+func (d *device) checkTemperature(ctx context.Context) (float64, error) {
+	if d.family() == familyRM4 {
+		temperature, _, err := d.checkSensors(ctx)
+		return temperature, err
+	}
+	resp, err := d.serverRequest(ctx, checkTemperaturePayload())
 	if err != nil {
-		return resp, fmt.Errorf("error making check temperature request: %v", err)
+		return 0, fmt.Errorf("error making check temperature request: %w", err)
 	}
 	if resp.Type == DeviceError {
-		return resp, errors.New("device responded with an error code")
+		return 0, resp.deviceError()
 	}
-	return resp, nil
+	if resp.Type != Temperature || len(resp.Data) < 2 {
+		return 0, fmt.Errorf("unexpected response type %v while checking temperature", resp.Type)
+	}
+	return float64(resp.Data[0]) + float64(resp.Data[1])/10, nil
 }
 
+// checkSensors returns the temperature in degrees Celsius and the relative
+// humidity in percent measured by an RM4 device. Each reading is reported as
+// an integer part followed by hundredths.
+func (d *device) checkSensors(ctx context.Context) (float64, float64, error) {
+	resp, err := d.serverRequest(ctx, checkSensorsPayload())
+	if err != nil {
+		return 0, 0, fmt.Errorf("error making check sensors request: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return 0, 0, resp.deviceError()
+	}
+	if resp.Type != SensorData || len(resp.Data) < 4 {
+		return 0, 0, fmt.Errorf("unexpected response type %v while checking sensors", resp.Type)
+	}
+	temperature := float64(resp.Data[0]) + float64(resp.Data[1])/100
+	humidity := float64(resp.Data[2]) + float64(resp.Data[3])/100
+	return temperature, humidity, nil
+}
+
+// learningDone returns an error if learning should stop because ctx, which is
+// parent with the learning timeout applied, is done. ErrLearnTimeout is only
+// returned if the learning timeout expired - if parent is done, its error is
+// wrapped instead. The device is taken out of learning mode before returning.
+func (d *device) learningDone(parent, ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	d.cancelLearn()
+	if err := parent.Err(); err != nil {
+		return fmt.Errorf("learning cancelled: %w", err)
+	}
+	return ErrLearnTimeout
+}
+
+// pollDelay pauses between polls of a device in learning mode so that it isn't
+// flooded with requests.
+func pollDelay(ctx context.Context) {
+	t := time.NewTimer(learnPollInterval)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// cancelLearn takes the device out of learning mode. It does not wait for a
+// response so that the caller is released right away. The response is still
+// expected so that it is not logged as stale when it arrives.
 func (d *device) cancelLearn() {
-	//d.sendPacket(cancelLearnPayload())
-	//d.close()
-	d.serverRequest(cancelLearnPayload())
-	d.close()
+	if err := d.setupConnection(); err != nil {
+		log.Printf("Could not cancel learning mode: %v", err)
+		return
+	}
+	packet, err := d.encryptRequest(cancelLearnPayload(d.family()))
+	if err == nil {
+		d.expectResponse(packetCount(packet))
+		err = d.send(packet)
+	}
+	if err != nil {
+		log.Printf("Could not cancel learning mode: %v", err)
+	}
 }
 
-func (d *device) setPowerState(data string) error {
+func (d *device) setPowerState(ctx context.Context, data string) error {
 	var state bool
+	var err error
 	if data == "00" || data == "0" {
 		state = false
 	} else if data == "01" || data == "1" {
@@ -514,14 +844,20 @@ func (d *device) setPowerState(data string) error {
 		return fmt.Errorf("set power state expects an argument of 0, 00, 1, or 01 - got %v instead", data)
 	}
 
-	resp, err := d.serverRequest(setPowerStatePayload(state))
-	d.close()
+	// Preserve the nightlight, which is set by the same request.
+	nightlight := false
+	if isKnownDevice(d.deviceType).nightlight {
+		if _, nightlight, err = d.getState(ctx); err != nil {
+			return err
+		}
+	}
 
+	resp, err := d.serverRequest(ctx, setPowerStatePayload(state, nightlight))
 	if err != nil {
-		return fmt.Errorf("error while making server request to set power state: %v", err)
+		return fmt.Errorf("error while making server request to set power state: %w", err)
 	}
 	if resp.Type == DeviceError {
-		return errors.New("device responded with an error code")
+		return resp.deviceError()
 	}
 	if resp.Type != CommandOK {
 		return fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
@@ -530,31 +866,69 @@ func (d *device) setPowerState(data string) error {
 	return nil
 }
 
-func (d *device) getPowerState() (bool, error) {
-	resp, err := d.serverRequest(getPowerStatePayload())
-	d.close()
+func (d *device) getPowerState(ctx context.Context) (bool, error) {
+	power, _, err := d.getState(ctx)
+	return power, err
+}
 
+// getState returns the state of the relay and of the nightlight. They are
+// reported in bits 0 and 1 of the same byte.
+func (d *device) getState(ctx context.Context) (bool, bool, error) {
+	resp, err := d.serverRequest(ctx, getPowerStatePayload())
 	if err != nil {
-		return false, fmt.Errorf("error while making server request to get power state: %v", err)
+		return false, false, fmt.Errorf("error while making server request to get power state: %w", err)
 	}
 	if resp.Type == DeviceError {
-		return false, errors.New("device responded with an error code")
+		return false, false, resp.deviceError()
 	}
 	if resp.Type != CommandOK {
-		return false, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
+		return false, false, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
 	}
-	if len(resp.Data) < 5 {
-		return false, fmt.Errorf("received a response payload of length %v - expected at least 5 bytes", len(resp.Data))
+	if len(resp.Data) < 1 {
+		return false, false, errors.New("received an empty response payload")
 	}
-	b := resp.Data[4]
-	switch b {
-	case 0:
-		return false, nil
-	case 1:
-		return true, nil
-	default:
-		return false, fmt.Errorf("received unknown state - expected 0 or 1 but got 0x%02x instead", b)
+	state := resp.Data[0]
+	return state&0x01 != 0, state&0x02 != 0, nil
+}
+
+// setNightlight turns the nightlight of an SP3 on or off without changing the
+// state of the relay.
+func (d *device) setNightlight(ctx context.Context, nightlight bool) error {
+	power, _, err := d.getState(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := d.serverRequest(ctx, setPowerStatePayload(power, nightlight))
+	if err != nil {
+		return fmt.Errorf("error while making server request to set nightlight: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return resp.deviceError()
+	}
+	log.Print("Set nightlight successful")
+	return nil
+}
+
+// getEnergy returns the power consumption in watts measured by an SP3S. The
+// reading is encoded in BCD, with the hundredths in byte 5 of the payload and
+// the integer part in bytes 6 and 7.
+func (d *device) getEnergy(ctx context.Context) (float64, error) {
+	resp, err := d.serverRequest(ctx, getEnergyPayload())
+	if err != nil {
+		return 0, fmt.Errorf("error while making server request to get energy: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return 0, resp.deviceError()
 	}
+	if resp.Type != CommandOK || len(resp.Data) < 4 {
+		return 0, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
+	}
+	whole := fromBCD(resp.Data[3])*100 + fromBCD(resp.Data[2])
+	return float64(whole) + float64(fromBCD(resp.Data[1]))/100, nil
+}
+
+func fromBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0f)
 }
 
 func authenticatePayload() unencryptedRequest {
@@ -590,17 +964,45 @@ func authenticatePayload() unencryptedRequest {
 	return req
 }
 
-func checkDataPayload() unencryptedRequest {
+// probePayload is a read-only query - RM devices treat it as a temperature
+// check, RM4 devices as a sensor check and SP devices as a power state query.
+// It returns false if the device can't be probed because it may be a Hysen
+// or a Dooya device, which don't share a read-only query.
+func probePayload(f deviceFamily) (unencryptedRequest, bool) {
+	switch f {
+	case familyRM4:
+		return checkSensorsPayload(), true
+	case familyMP1:
+		return getOutletStatesPayload(), true
+	case familyHysen:
+		return hysenPayload([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}), true
+	case familyDooya:
+		return dooyaPayload(0x06, 0x5d), true
+	case familyHysenOrDooya:
+		return unencryptedRequest{}, false
+	case familyS1:
+		return getAlarmSensorsPayload(), true
+	case familyLB1:
+		req, _ := bulbPayload(bulbGetState, map[string]interface{}{})
+		return req, true
+	}
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: basicRequestPayload(1),
+	}, true
+}
+
+func checkDataPayload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(4),
+		payload: rmPayload(f, 4, nil),
 	}
 }
 
-func enterLearningPayload() unencryptedRequest {
+func enterLearningPayload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(3),
+		payload: rmPayload(f, 3, nil),
 	}
 }
 
@@ -611,43 +1013,52 @@ func checkTemperaturePayload() unencryptedRequest {
 	}
 }
 
-func cancelLearnPayload() unencryptedRequest {
+func checkSensorsPayload() unencryptedRequest {
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: rmPayload(familyRM4, 0x24, nil),
+	}
+}
+
+func cancelLearnPayload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(0x1e),
+		payload: rmPayload(f, 0x1e, nil),
 	}
 }
 
-func enterRFSweepPayload() unencryptedRequest {
+func enterRFSweepPayload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(0x19),
+		payload: rmPayload(f, 0x19, nil),
 	}
 }
 
-func checkRFDataPayload() unencryptedRequest {
+func checkRFDataPayload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(0x1a),
+		payload: rmPayload(f, 0x1a, nil),
 	}
 }
 
-func checkRFData2Payload() unencryptedRequest {
+func checkRFData2Payload(f deviceFamily) unencryptedRequest {
 	return unencryptedRequest{
 		command: 0x6a,
-		payload: basicRequestPayload(0x1b),
+		payload: rmPayload(f, 0x1b, nil),
 	}
 }
 
 // Based on the following paragraph from https://blog.ipsumdomus.com/broadlink-smart-home-devices-complete-protocol-hack-bc0b4b397af1:
 // Command (16 bytes message id 0x6a payload) always has Get (byte 0x1) or Set
 // (byte 0x2) at byte 0 and state (On — 0x1 and Off — 0x0) at byte 4.
-func setPowerStatePayload(state bool) unencryptedRequest {
+// On an SP3, bit 1 of the state controls the nightlight.
+func setPowerStatePayload(state, nightlight bool) unencryptedRequest {
 	var stateValue byte
 	if state {
 		stateValue = 0x01
-	} else {
-		stateValue = 0x00
+	}
+	if nightlight {
+		stateValue |= 0x02
 	}
 	p := basicRequestPayload(0x02)
 	p[4] = stateValue
@@ -664,8 +1075,40 @@ func getPowerStatePayload() unencryptedRequest {
 	}
 }
 
+func getEnergyPayload() unencryptedRequest {
+	p := basicRequestPayload(0x08)
+	copy(p[1:], []byte{0, 254, 1, 5, 1, 0, 0, 0, 45})
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: p,
+	}
+}
+
 func basicRequestPayload(command byte) []byte {
 	payload := make([]byte, 16, 16)
 	payload[0] = command
 	return payload
 }
+
+// rmPayload builds the payload of an RM command: the command in the first
+// byte, followed by data at offset 4. RM4 devices expect the whole thing to be
+// prefixed with its length as a 2-byte little-endian integer. The payload is
+// zero-padded to a multiple of 16 bytes for encryption.
+func rmPayload(f deviceFamily, command byte, data []byte) []byte {
+	offset := 0
+	if f == familyRM4 {
+		offset = 2
+	}
+	size := offset + 4 + len(data)
+	if rem := size % 16; rem != 0 {
+		size += 16 - rem
+	}
+	payload := make([]byte, size, size)
+	if f == familyRM4 {
+		payload[0] = (byte)((len(data) + 4) & 0xff)
+		payload[1] = (byte)((len(data) + 4) >> 8)
+	}
+	payload[offset] = command
+	copy(payload[offset+4:], data)
+	return payload
+}
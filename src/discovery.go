@@ -0,0 +1,240 @@
+package broadlinkrm
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+const maxDiscoveryTargets = 65536
+
+// DiscoverOptions controls where discovery packets are sent. If all fields are
+// empty, a single packet is broadcast to 255.255.255.255.
+type DiscoverOptions struct {
+	// Interfaces lists network interface names (e.g. eth0). A packet is
+	// broadcast on the subnet of every IPv4 address of each interface.
+	Interfaces []string
+
+	// BroadcastAddrs lists additional broadcast addresses (e.g.
+	// 192.168.2.255). Use these to reach subnets that are routed to this
+	// host.
+	BroadcastAddrs []string
+
+	// Targets lists IP addresses or CIDR ranges (e.g. 10.0.5.0/24) that are
+	// probed with unicast packets. Use these for devices on other VLANs or
+	// behind routers that do not forward broadcasts.
+	Targets []string
+}
+
+// DiscoveryResult describes a device that responded to a discovery packet.
+type DiscoveryResult struct {
+	IP           string
+	MAC          string
+	DeviceType   int
+	Model        string
+	Known        bool // the device type is listed in knownDevices
+	Supported    bool // the device type can be controlled by this library
+	Capabilities Capabilities
+
+	// Name is the name that the device was given in the vendor app. Locked
+	// is true if the device only accepts authentication from the app that
+	// set it up. Cloud is true if the device is registered with the vendor's
+	// cloud.
+	Name   string
+	Locked bool
+	Cloud  bool
+
+	// Authenticated is true if the device was authenticated and added during
+	// this discovery. AlreadyKnown is true if it had been added previously.
+	Authenticated bool
+	AlreadyKnown  bool
+
+	// Err is set if authentication failed.
+	Err error
+}
+
+// StartRediscovery repeats discovery every interval in the background until
+// ctx is done. New devices are added as they are found. When a known device
+// answers from a new IP address, its address is updated, it is
+// re-authenticated if it rejects its credentials, and an AddressChanged event
+// is published.
+func (b *Broadlink) StartRediscovery(ctx context.Context, interval time.Duration, opts DiscoverOptions) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := b.DiscoverWithOptions(ctx, opts)
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Error during rediscovery: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// moveDevice points a known device at a new IP address.
+func (b *Broadlink) moveDevice(ctx context.Context, d *device, ip string) {
+	if err := d.acquire(ctx); err != nil {
+		log.Printf("Could not update address of device %v: %v", d.mac.String(), err)
+		return
+	}
+	defer d.release()
+
+	previous := d.address()
+	if previous == ip {
+		return
+	}
+	log.Printf("Device %v moved from %v to %v", d.mac.String(), previous, ip)
+
+	b.mu.Lock()
+	if b.lookup[strings.ToLower(previous)] == d {
+		delete(b.lookup, strings.ToLower(previous))
+	}
+	b.lookup[strings.ToLower(ip)] = d
+	b.mu.Unlock()
+	d.setAddress(ip)
+
+	reauthenticated, err := d.refreshCredentials(ctx)
+	if err != nil {
+		log.Printf("Could not verify credentials of device %v: %v", d.mac.String(), err)
+	}
+
+	b.publish(Event{
+		Type:            AddressChanged,
+		MAC:             d.mac.String(),
+		IP:              ip,
+		PreviousIP:      previous,
+		Reauthenticated: reauthenticated,
+	})
+}
+
+// destinations returns the list of IP addresses that discovery packets should
+// be sent to.
+func (opts DiscoverOptions) destinations() ([]string, error) {
+	dests := []string{}
+	seen := make(map[string]bool)
+	add := func(ip string) {
+		if seen[ip] {
+			return
+		}
+		seen[ip] = true
+		dests = append(dests, ip)
+	}
+
+	for _, name := range opts.Interfaces {
+		addrs, err := interfaceBroadcastAddrs(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			add(a)
+		}
+	}
+
+	for _, a := range opts.BroadcastAddrs {
+		ip := net.ParseIP(a).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("%v is not a valid IPv4 broadcast address", a)
+		}
+		add(ip.String())
+	}
+
+	for _, t := range opts.Targets {
+		ips, err := expandTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		if len(dests)+len(ips) > maxDiscoveryTargets {
+			return nil, fmt.Errorf("discovery targets expand to more than %d addresses", maxDiscoveryTargets)
+		}
+		for _, ip := range ips {
+			add(ip)
+		}
+	}
+
+	if len(dests) == 0 {
+		add("255.255.255.255")
+	}
+	return dests, nil
+}
+
+// interfaceBroadcastAddrs returns the broadcast address of each IPv4 subnet
+// that the named interface is on.
+func interfaceBroadcastAddrs(name string) ([]string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find interface %v: %v", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not get addresses of interface %v: %v", name, err)
+	}
+	resp := []string{}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		mask := net.IP(ipnet.Mask).To4()
+		if mask == nil {
+			mask = net.IP(ipnet.Mask[len(ipnet.Mask)-4:])
+		}
+		bcast := make(net.IP, 4)
+		for i := range bcast {
+			bcast[i] = ip[i] | ^mask[i]
+		}
+		resp = append(resp, bcast.String())
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("interface %v does not have an IPv4 address", name)
+	}
+	return resp, nil
+}
+
+// expandTarget turns an IP address or a CIDR range into a list of host
+// addresses.
+func expandTarget(t string) ([]string, error) {
+	if ip := net.ParseIP(t).To4(); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(t)
+	if err != nil {
+		return nil, fmt.Errorf("%v is neither an IPv4 address nor a CIDR range", t)
+	}
+	base := ipnet.IP.To4()
+	if base == nil {
+		return nil, fmt.Errorf("%v is not an IPv4 CIDR range", t)
+	}
+	ones, bits := ipnet.Mask.Size()
+	hostBits := uint(bits - ones)
+	if hostBits > 16 {
+		return nil, fmt.Errorf("CIDR range %v is too large - use a prefix of /16 or longer", t)
+	}
+	size := uint32(1) << hostBits
+	first, last := uint32(0), size-1
+	if hostBits >= 2 {
+		// Skip the network and broadcast addresses.
+		first, last = 1, size-2
+	}
+
+	start := binary.BigEndian.Uint32(base)
+	resp := make([]string, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i)
+		resp = append(resp, ip.String())
+	}
+	return resp, nil
+}
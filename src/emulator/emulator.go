@@ -0,0 +1,1027 @@
+// Package emulator implements a fake Broadlink device that speaks the same UDP
+// protocol as the real hardware. It lets you exercise discovery, learning and
+// sending without an RM or SP on the network.
+package emulator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var defaultKey = []byte{0x09, 0x76, 0x28, 0x34, 0x3f, 0xe9, 0x9e, 0x23, 0x76, 0x5c, 0x15, 0x13, 0xac, 0xcf, 0x8b, 0x02}
+var defaultIV = []byte{0x56, 0x2e, 0x17, 0x99, 0x6d, 0x09, 0x3d, 0x28, 0xdd, 0xb3, 0xba, 0x69, 0x5a, 0x2e, 0x6f, 0x58}
+
+// Error codes that the emulator places at offset 0x22 of a response.
+const (
+	errorAuth        = -7 // control key is expired
+	errorNothingRead = -5 // returned by check data when nothing was learned
+	errorNotSupport  = -4
+)
+
+// Protocol selects the command set that the emulated device responds to.
+type Protocol int
+
+// Enumerations of Protocol.
+const (
+	RM    Protocol = iota // IR / RF blaster
+	SP2                   // WiFi-enabled power outlet (SP2, SP3, SP3S, SP Mini)
+	RM4                   // IR / RF blaster with length-prefixed payloads
+	MP1                   // power strip with 4 outlets
+	A1                    // environmental sensor
+	Hysen                 // heating controller
+	Dooya                 // curtain motor
+	S1                    // alarm hub
+	LB1                   // smart bulb
+)
+
+// Config describes the device that is being emulated.
+type Config struct {
+	// Addr is the UDP address to listen on. Defaults to 127.0.0.1:0.
+	Addr       string
+	Protocol   Protocol
+	DeviceType int
+	MAC        net.HardwareAddr
+	Name       string
+	Locked     bool
+	Cloud      bool
+	Firmware   int
+
+	// Key and ID are the credentials handed out during authentication. If
+	// they are not set, random values are generated.
+	Key []byte
+	ID  []byte
+
+	Temperature float64
+	Humidity    float64 // only reported by RM4 and A1
+	Energy      float64 // watts, only reported by SP2
+	Latency     time.Duration
+
+	// Light, AirQuality and Noise are the levels reported by an A1.
+	Light      int
+	AirQuality int
+	Noise      int
+
+	// LearnDelay is the time between entering learning mode and a queued
+	// code becoming available, simulating the user pressing a button.
+	LearnDelay time.Duration
+}
+
+// Emulator is a running fake device.
+type Emulator struct {
+	cfg  Config
+	conn net.PacketConn
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu          sync.Mutex
+	key         []byte
+	id          []byte
+	latency     time.Duration
+	learning    bool
+	sweeping    bool
+	learnStart  time.Time
+	codes       [][]byte
+	rfCodes     [][]byte
+	emitted     [][]byte
+	power       bool
+	nightlight  bool
+	outlets     byte   // bit mask of the MP1 outlets that are on
+	hysen       []byte // Hysen status registers
+	curtain     int    // Dooya position in percent
+	curtainStep int    // change in position per query while the motor runs
+	alarm       []alarmSensor
+	bulb        map[string]int // LB1 state as JSON keys and values
+	wifi        WiFiSettings
+	name        string
+	locked      bool
+	energy      float64
+	temperature float64
+	humidity    float64
+	failCode    int
+	failCount   int
+	dropCount   int
+}
+
+// Start creates an emulator and starts answering requests in the background.
+func Start(cfg Config) (*Emulator, error) {
+	if len(cfg.Addr) == 0 {
+		cfg.Addr = "127.0.0.1:0"
+	}
+	if len(cfg.MAC) == 0 {
+		cfg.MAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	}
+	if len(cfg.MAC) != 6 {
+		return nil, fmt.Errorf("MAC address %v should be 6 bytes long", cfg.MAC.String())
+	}
+	if len(cfg.Name) == 0 {
+		cfg.Name = "Emulator"
+	}
+
+	e := &Emulator{
+		cfg:         cfg,
+		done:        make(chan struct{}),
+		latency:     cfg.Latency,
+		temperature: cfg.Temperature,
+		humidity:    cfg.Humidity,
+		energy:      cfg.Energy,
+		name:        cfg.Name,
+		locked:      cfg.Locked,
+		hysen:       defaultHysenRegisters(cfg.Temperature),
+		bulb:        map[string]int{"pwr": 0, "brightness": 100, "bulb_colormode": 1, "colortemp": 50, "red": 255, "green": 255, "blue": 255},
+	}
+
+	if len(cfg.Key) == 0 {
+		e.key = randomBytes(16)
+	} else if len(cfg.Key) != 16 {
+		return nil, fmt.Errorf("key has length of %v bytes - it should have a length of 16 bytes", len(cfg.Key))
+	} else {
+		e.key = append([]byte{}, cfg.Key...)
+	}
+	if len(cfg.ID) == 0 {
+		e.id = randomBytes(4)
+	} else if len(cfg.ID) != 4 {
+		return nil, fmt.Errorf("id has length of %v bytes - it should have a length of 4 bytes", len(cfg.ID))
+	} else {
+		e.id = append([]byte{}, cfg.ID...)
+	}
+
+	conn, err := net.ListenPacket("udp4", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not bind UDP listener: %v", err)
+	}
+	e.conn = conn
+
+	e.wg.Add(1)
+	go e.serve()
+
+	log.Printf("Emulating device type 0x%04x, MAC %v on %v", cfg.DeviceType, cfg.MAC.String(), conn.LocalAddr().String())
+	return e, nil
+}
+
+// Close stops the emulator and releases its socket.
+func (e *Emulator) Close() error {
+	close(e.done)
+	err := e.conn.Close()
+	e.wg.Wait()
+	return err
+}
+
+// Addr returns the address that the emulator is listening on.
+func (e *Emulator) Addr() net.Addr {
+	return e.conn.LocalAddr()
+}
+
+// Port returns the UDP port that the emulator is listening on.
+func (e *Emulator) Port() int {
+	addr, ok := e.conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return 0
+	}
+	return addr.Port
+}
+
+// Key returns the session key as a hex string, in the format expected by
+// devices.json.
+func (e *Emulator) Key() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return hex.EncodeToString(e.key)
+}
+
+// ID returns the device ID as a hex string, in the format expected by
+// devices.json.
+func (e *Emulator) ID() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return hex.EncodeToString(e.id)
+}
+
+// AddLearnedCode queues an IR code that will be returned the next time the
+// device is put into learning mode.
+func (e *Emulator) AddLearnedCode(code []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.codes = append(e.codes, append([]byte{}, code...))
+}
+
+// AddLearnedRFCode queues an RF code that will be returned the next time an RF
+// sweep is performed.
+func (e *Emulator) AddLearnedRFCode(code []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rfCodes = append(e.rfCodes, append([]byte{}, code...))
+}
+
+// Emitted returns all the codes that the device was asked to send, in order.
+func (e *Emulator) Emitted() [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resp := make([][]byte, len(e.emitted))
+	for i, c := range e.emitted {
+		resp[i] = append([]byte{}, c...)
+	}
+	return resp
+}
+
+// ClearEmitted discards the record of emitted codes.
+func (e *Emulator) ClearEmitted() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.emitted = nil
+}
+
+// PowerState returns the state of an emulated power outlet.
+func (e *Emulator) PowerState() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.power
+}
+
+// SetPowerState changes the state of an emulated power outlet.
+func (e *Emulator) SetPowerState(state bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.power = state
+}
+
+// Nightlight returns the state of the nightlight of an emulated SP3.
+func (e *Emulator) Nightlight() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.nightlight
+}
+
+// SetNightlight changes the state of the nightlight of an emulated SP3.
+func (e *Emulator) SetNightlight(state bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nightlight = state
+}
+
+// OutletState returns the state of an outlet of an emulated MP1, numbered
+// from 1.
+func (e *Emulator) OutletState(outlet int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.outlets&(1<<uint(outlet-1)) != 0
+}
+
+// SetOutletState changes the state of an outlet of an emulated MP1, numbered
+// from 1.
+func (e *Emulator) SetOutletState(outlet int, state bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	mask := byte(1) << uint(outlet-1)
+	if state {
+		e.outlets |= mask
+	} else {
+		e.outlets &^= mask
+	}
+}
+
+// ThermostatRegisters returns a copy of the status registers of an emulated
+// Hysen heating controller, in the order that they are read.
+func (e *Emulator) ThermostatRegisters() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]byte{}, e.hysen...)
+}
+
+// CurtainPosition returns the position of an emulated Dooya curtain motor in
+// percent.
+func (e *Emulator) CurtainPosition() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.curtain
+}
+
+// SetCurtainPosition moves an emulated Dooya curtain motor to percent and
+// stops it.
+func (e *Emulator) SetCurtainPosition(percent int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.curtain = percent
+	e.curtainStep = 0
+}
+
+// AddAlarmSensor pairs a sensor with an emulated S1 hub. sensorType is 0x21
+// for a motion sensor, 0x31 for a door sensor and 0x91 for a key fob. serial
+// must be 4 bytes long.
+func (e *Emulator) AddAlarmSensor(sensorType byte, name string, serial []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := alarmSensor{sensorType: sensorType, name: name}
+	copy(s.serial[:], serial)
+	e.alarm = append(e.alarm, s)
+}
+
+// SetAlarmSensorStatus changes the raw status byte of the sensor with the
+// given serial number, e.g. 0x10 to open a door sensor and 0x00 to close it.
+func (e *Emulator) SetAlarmSensorStatus(serial []byte, status byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.alarm {
+		if bytes.Equal(e.alarm[i].serial[:], serial) {
+			e.alarm[i].status = status
+		}
+	}
+}
+
+// BulbState returns a copy of the state of an emulated LB1, keyed by the
+// names used in its JSON payloads (e.g. pwr and brightness).
+func (e *Emulator) BulbState() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state := make(map[string]int)
+	for k, v := range e.bulb {
+		state[k] = v
+	}
+	return state
+}
+
+// Name returns the name that the emulated device reports during discovery.
+func (e *Emulator) Name() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.name
+}
+
+// Locked returns the lock flag that the emulated device reports during
+// discovery.
+func (e *Emulator) Locked() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.locked
+}
+
+// SetEnergy changes the power in watts reported by an emulated SP3S.
+func (e *Emulator) SetEnergy(watts float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.energy = watts
+}
+
+// SetTemperature changes the temperature reported by the device.
+func (e *Emulator) SetTemperature(t float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.temperature = t
+}
+
+// SetHumidity changes the humidity reported by an RM4 device.
+func (e *Emulator) SetHumidity(h float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.humidity = h
+}
+
+// SetLatency delays every response by d.
+func (e *Emulator) SetLatency(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latency = d
+}
+
+// InjectError makes the device respond to the next n commands with the given
+// error code (e.g. -5).
+func (e *Emulator) InjectError(code, n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failCode = code
+	e.failCount = n
+}
+
+// DropNext makes the device silently ignore the next n requests.
+func (e *Emulator) DropNext(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dropCount = n
+}
+
+func (e *Emulator) serve() {
+	defer e.wg.Done()
+	var buf [2048]byte
+	for {
+		plen, remote, err := e.conn.ReadFrom(buf[:])
+		if err != nil {
+			select {
+			case <-e.done:
+				return
+			default:
+			}
+			log.Printf("Error reading UDP packet: %v", err)
+			continue
+		}
+		packet := make([]byte, plen)
+		copy(packet, buf[:plen])
+
+		e.mu.Lock()
+		latency := e.latency
+		drop := e.dropCount > 0
+		if drop {
+			e.dropCount--
+		}
+		e.mu.Unlock()
+
+		if drop {
+			log.Printf("Dropping packet from %v", remote.String())
+			continue
+		}
+		resp, err := e.handle(packet)
+		if err != nil {
+			log.Printf("Ignoring packet from %v: %v", remote.String(), err)
+			continue
+		}
+		if resp == nil {
+			continue
+		}
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if _, err := e.conn.WriteTo(resp, remote); err != nil {
+			log.Printf("Error writing response to %v: %v", remote.String(), err)
+		}
+	}
+}
+
+func (e *Emulator) handle(packet []byte) ([]byte, error) {
+	if len(packet) < 0x30 {
+		return nil, fmt.Errorf("packet of length %v is too short", len(packet))
+	}
+	if !validChecksum(packet) {
+		return nil, errors.New("invalid checksum")
+	}
+	if packet[0x26] == 6 {
+		return e.hello(), nil
+	}
+	if packet[0x26] == 0x14 {
+		return nil, e.join(packet)
+	}
+	if len(packet) < 0x38 || (len(packet)-0x38)%16 != 0 {
+		return nil, fmt.Errorf("command packet has an invalid length of %v", len(packet))
+	}
+	for i, b := range []byte{0x5a, 0xa5, 0xaa, 0x55, 0x5a, 0xa5, 0xaa, 0x55} {
+		if packet[i] != b {
+			return nil, errors.New("invalid magic bytes")
+		}
+	}
+
+	switch packet[0x26] {
+	case 0x65:
+		return e.authenticate(packet)
+	case 0x6a:
+		return e.command(packet)
+	}
+	return nil, fmt.Errorf("unhandled command 0x%02x", packet[0x26])
+}
+
+// WiFiSettings holds the network details sent to a device in AP mode.
+type WiFiSettings struct {
+	SSID     string
+	Password string
+	Security int
+}
+
+// WiFi returns the network details from the last join command. The device
+// does not answer the command, and keeps answering on its current address.
+func (e *Emulator) WiFi() WiFiSettings {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.wifi
+}
+
+func (e *Emulator) join(packet []byte) error {
+	if len(packet) < 0x88 {
+		return fmt.Errorf("join packet has an invalid length of %v", len(packet))
+	}
+	ssidLen, passLen := int(packet[0x84]), int(packet[0x85])
+	if ssidLen > 32 || passLen > 32 {
+		return errors.New("join packet has an invalid SSID or password length")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.wifi = WiFiSettings{
+		SSID:     string(packet[0x44 : 0x44+ssidLen]),
+		Password: string(packet[0x64 : 0x64+passLen]),
+		Security: int(packet[0x86]),
+	}
+	log.Printf("Joining WiFi network %v", e.wifi.SSID)
+	return nil
+}
+
+func (e *Emulator) hello() []byte {
+	resp := make([]byte, 0x80)
+	resp[0x26] = 7
+	resp[0x34] = byte(e.cfg.DeviceType & 0xff)
+	resp[0x35] = byte(e.cfg.DeviceType >> 8)
+	for i := 0; i < 6; i++ {
+		resp[0x3a+i] = e.cfg.MAC[5-i]
+	}
+	e.mu.Lock()
+	copy(resp[0x40:0x7e], e.name)
+	resp[0x7e] = boolByte(e.cfg.Cloud)
+	resp[0x7f] = boolByte(e.locked)
+	e.mu.Unlock()
+	setChecksum(resp)
+	return resp
+}
+
+func (e *Emulator) authenticate(packet []byte) ([]byte, error) {
+	if _, err := decrypt(defaultKey, packet[0x38:]); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	payload := make([]byte, 0x20)
+	copy(payload[0x00:], e.id)
+	copy(payload[0x04:], e.key)
+	e.mu.Unlock()
+
+	log.Printf("Authentication request from client")
+	return e.response(packet, 0xe9, 0, defaultKey, payload)
+}
+
+func (e *Emulator) command(packet []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := 0; i < 4; i++ {
+		if packet[0x30+i] != e.id[i] {
+			return e.response(packet, 0xee, errorAuth, e.key, make([]byte, 16))
+		}
+	}
+	if e.failCount > 0 {
+		e.failCount--
+		return e.response(packet, 0xee, e.failCode, e.key, make([]byte, 16))
+	}
+
+	payload, err := decrypt(e.key, packet[0x38:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The firmware and device name commands are understood by every
+	// protocol and never carry an RM4 length prefix. The device name command
+	// is the only one with a command word of 0.
+	if len(payload) == 16 && payload[0] == 0x68 {
+		return e.response(packet, 0xee, 0, e.key, []byte{0x68, 0, 0, 0, byte(e.cfg.Firmware), byte(e.cfg.Firmware >> 8)})
+	}
+	if len(payload) >= 0x44 && binary.LittleEndian.Uint32(payload) == 0 {
+		name := payload[0x04:0x43]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		e.name = string(name)
+		e.locked = payload[0x43] != 0
+		log.Printf("Renamed to %v, locked: %v", e.name, e.locked)
+		return e.response(packet, 0xee, 0, e.key, make([]byte, 16))
+	}
+
+	var out []byte
+	var code int
+	switch e.cfg.Protocol {
+	case RM:
+		out, code = e.rmCommand(payload)
+	case RM4:
+		out, code = e.rm4Command(payload)
+	case SP2:
+		out, code = e.spCommand(payload)
+	case MP1:
+		out, code = e.mp1Command(payload)
+	case A1:
+		out, code = e.a1Command(payload)
+	case Hysen:
+		out, code = e.hysenCommand(payload)
+	case Dooya:
+		out, code = e.dooyaCommand(payload)
+	case S1:
+		out, code = e.s1Command(payload)
+	case LB1:
+		out, code = e.lb1Command(payload)
+	default:
+		code = errorNotSupport
+	}
+	if out == nil {
+		out = []byte{payload[0], 0, 0, 0}
+	}
+	return e.response(packet, 0xee, code, e.key, out)
+}
+
+func (e *Emulator) rmCommand(payload []byte) ([]byte, int) {
+	switch payload[0] {
+	case 0x01:
+		whole := int(e.temperature)
+		return []byte{0x01, 0, 0, 0, byte(whole), byte(int((e.temperature-float64(whole))*10+0.5) % 10)}, 0
+	case 0x02:
+		code := trimCode(payload[4:])
+		e.emitted = append(e.emitted, code)
+		log.Printf("Emitted code %v", hex.EncodeToString(code))
+		return nil, 0
+	case 0x03:
+		e.learning = true
+		e.sweeping = false
+		e.learnStart = time.Now()
+		log.Print("Entered learning mode")
+		return nil, 0
+	case 0x04:
+		if !e.learning || time.Since(e.learnStart) < e.cfg.LearnDelay {
+			return nil, errorNothingRead
+		}
+		var code []byte
+		if len(e.codes) > 0 {
+			code, e.codes = e.codes[0], e.codes[1:]
+		} else if len(e.rfCodes) > 0 {
+			code, e.rfCodes = e.rfCodes[0], e.rfCodes[1:]
+		} else {
+			return nil, errorNothingRead
+		}
+		e.learning = false
+		log.Printf("Returning learned code %v", hex.EncodeToString(code))
+		return append([]byte{0x04, 0, 0, 0}, code...), 0
+	case 0x19:
+		e.sweeping = true
+		e.learning = false
+		e.learnStart = time.Now()
+		log.Print("Started RF frequency sweep")
+		return nil, 0
+	case 0x1a:
+		found := byte(0)
+		if e.sweeping && len(e.rfCodes) > 0 && time.Since(e.learnStart) >= e.cfg.LearnDelay {
+			found = 1
+		}
+		return []byte{0x1a, 0, 0, 0, found}, 0
+	case 0x1b:
+		if e.sweeping {
+			e.sweeping = false
+			e.learning = true
+		}
+		return nil, 0
+	case 0x1e:
+		e.learning = false
+		e.sweeping = false
+		log.Print("Cancelled learning mode")
+		return nil, 0
+	}
+	return nil, errorNotSupport
+}
+
+// rm4Command strips the length prefix off the payload, handles the command
+// like an RM device and prefixes the response with its length.
+func (e *Emulator) rm4Command(payload []byte) ([]byte, int) {
+	l := 2 + (int(payload[0]) | int(payload[1])<<8)
+	if l < 6 || l > len(payload) {
+		return nil, errorNotSupport
+	}
+	inner := payload[2:l]
+
+	var out []byte
+	code := 0
+	if inner[0] == 0x24 {
+		out = append([]byte{0x24, 0, 0, 0}, append(splitReading(e.temperature), splitReading(e.humidity)...)...)
+	} else {
+		out, code = e.rmCommand(inner)
+	}
+	if out == nil {
+		out = []byte{inner[0], 0, 0, 0}
+	}
+	return append([]byte{byte(len(out) & 0xff), byte(len(out) >> 8)}, out...), code
+}
+
+// splitReading encodes a sensor reading as an integer part and hundredths.
+func splitReading(v float64) []byte {
+	hundredths := int(v*100 + 0.5)
+	return []byte{byte(hundredths / 100), byte(hundredths % 100)}
+}
+
+func (e *Emulator) spCommand(payload []byte) ([]byte, int) {
+	switch payload[0] {
+	case 0x01:
+		return []byte{0x01, 0, 0, 0, e.spState()}, 0
+	case 0x02:
+		e.power = payload[4]&0x01 != 0
+		e.nightlight = payload[4]&0x02 != 0
+		log.Printf("Power state set to %v, nightlight to %v", e.power, e.nightlight)
+		return []byte{0x02, 0, 0, 0, e.spState()}, 0
+	case 0x08:
+		hundredths := int(e.energy*100 + 0.5)
+		return []byte{0x08, 0, 0, 0, 0, toBCD(hundredths % 100), toBCD(hundredths / 100 % 100), toBCD(hundredths / 10000 % 100)}, 0
+	}
+	return nil, errorNotSupport
+}
+
+func (e *Emulator) a1Command(payload []byte) ([]byte, int) {
+	if payload[0] != 0x01 {
+		return nil, errorNotSupport
+	}
+	t := int(e.temperature*10 + 0.5)
+	h := int(e.humidity*10 + 0.5)
+	return []byte{
+		0x01, 0, 0, 0,
+		byte(t / 10), byte(t % 10), byte(h / 10), byte(h % 10),
+		byte(e.cfg.Light), 0, byte(e.cfg.AirQuality), 0, byte(e.cfg.Noise),
+	}, 0
+}
+
+// defaultHysenRegisters returns the status registers of a Hysen heating
+// controller that is on, in manual mode, set to 22 degrees.
+func defaultHysenRegisters(temperature float64) []byte {
+	r := make([]byte, 0x2c)
+	r[1] = 0x01 // power
+	r[2] = byte(temperature * 2)
+	r[3] = 22 * 2
+	r[4] = 0x10 // loop mode 0, manual
+	r[15] = byte(temperature * 2)
+	r[16], r[17], r[18], r[19] = 12, 0, 0, 1
+	for i := 0; i < 8; i++ {
+		r[2*i+20] = byte(6 + 2*i)
+		r[i+36] = 20 * 2
+	}
+	return r
+}
+
+func (e *Emulator) hysenCommand(payload []byte) ([]byte, int) {
+	l := int(payload[0])
+	if l < 4 || l+2 > len(payload) {
+		return nil, errorNotSupport
+	}
+	request := payload[2:l]
+	crc := crc16(request)
+	if payload[l] != byte(crc&0xff) || payload[l+1] != byte(crc>>8) {
+		log.Print("Invalid Hysen CRC")
+		return nil, errorNotSupport
+	}
+	if len(request) < 6 {
+		return nil, errorNotSupport
+	}
+
+	var resp []byte
+	switch request[1] {
+	case 0x03:
+		count := 2 * (int(request[4])<<8 | int(request[5]))
+		if count > len(e.hysen) {
+			count = len(e.hysen)
+		}
+		resp = append([]byte{request[0], 0x03, byte(count)}, e.hysen[:count]...)
+	case 0x06:
+		switch request[3] {
+		case 0x00:
+			e.hysen[0], e.hysen[1] = request[4], request[5]
+		case 0x01:
+			e.hysen[3] = request[5]
+		case 0x02:
+			e.hysen[4], e.hysen[5] = request[4], request[5]
+		default:
+			return nil, errorNotSupport
+		}
+		log.Printf("Thermostat register %d set to 0x%02x%02x", request[3], request[4], request[5])
+		resp = append([]byte{}, request[:6]...)
+	default:
+		return nil, errorNotSupport
+	}
+
+	crc = crc16(resp)
+	out := append([]byte{byte(len(resp) + 2), 0}, resp...)
+	return append(out, byte(crc&0xff), byte(crc>>8)), 0
+}
+
+// dooyaCommand moves the emulated curtain by 10% every time its position is
+// queried while the motor is running.
+func (e *Emulator) dooyaCommand(payload []byte) ([]byte, int) {
+	if payload[0] != 0x09 || payload[2] != 0xbb {
+		return nil, errorNotSupport
+	}
+	switch payload[3] {
+	case 0x01:
+		e.curtainStep = 10
+	case 0x02:
+		e.curtainStep = -10
+	case 0x03:
+		e.curtainStep = 0
+	case 0x06:
+		e.curtain += e.curtainStep
+		if e.curtain >= 100 || e.curtain <= 0 {
+			e.curtainStep = 0
+		}
+		if e.curtain > 100 {
+			e.curtain = 100
+		}
+		if e.curtain < 0 {
+			e.curtain = 0
+		}
+	default:
+		return nil, errorNotSupport
+	}
+	return []byte{0x09, 0, 0xbb, payload[3], byte(e.curtain)}, 0
+}
+
+type alarmSensor struct {
+	status     byte
+	sensorType byte
+	name       string
+	serial     [4]byte
+}
+
+func (e *Emulator) s1Command(payload []byte) ([]byte, int) {
+	if payload[0] != 0x06 {
+		return nil, errorNotSupport
+	}
+	out := []byte{0x06, 0, 0, 0, byte(len(e.alarm)), 0}
+	for i, s := range e.alarm {
+		r := make([]byte, 83)
+		r[0] = s.status
+		r[1] = byte(i)
+		r[3] = s.sensorType
+		copy(r[4:26], s.name)
+		copy(r[26:30], s.serial[:])
+		out = append(out, r...)
+	}
+	return out, 0
+}
+
+func (e *Emulator) lb1Command(payload []byte) ([]byte, int) {
+	if len(payload) < 0x0e || payload[2] != 0xa5 || payload[4] != 0x5a {
+		return nil, errorNotSupport
+	}
+	l := int(binary.LittleEndian.Uint32(payload[0x0a:]))
+	if 0x0e+l > len(payload) {
+		return nil, errorNotSupport
+	}
+	if payload[0x08] == 2 {
+		update := make(map[string]int)
+		if err := json.Unmarshal(payload[0x0e:0x0e+l], &update); err != nil {
+			log.Printf("Could not decode bulb state: %v", err)
+			return nil, errorNotSupport
+		}
+		for k, v := range update {
+			e.bulb[k] = v
+		}
+		log.Printf("Bulb state set to %v", e.bulb)
+	}
+
+	data, err := json.Marshal(e.bulb)
+	if err != nil {
+		return nil, errorNotSupport
+	}
+	out := make([]byte, 0x0e, 0x0e+len(data))
+	binary.LittleEndian.PutUint16(out[0x00:], uint16(12+len(data)))
+	binary.LittleEndian.PutUint16(out[0x02:], 0xa5a5)
+	binary.LittleEndian.PutUint16(out[0x04:], 0x5a5a)
+	out[0x08] = payload[0x08]
+	out[0x09] = 0x0b
+	binary.LittleEndian.PutUint32(out[0x0a:], uint32(len(data)))
+	return append(out, data...), 0
+}
+
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&0x0001 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+func (e *Emulator) mp1Command(payload []byte) ([]byte, int) {
+	switch payload[0] {
+	case 0x0a:
+		out := make([]byte, 16)
+		out[0] = 0x0a
+		out[0x0e] = e.outlets
+		return out, 0
+	case 0x0d:
+		mask := payload[0x0d]
+		e.outlets = e.outlets&^mask | payload[0x0e]&mask
+		log.Printf("Outlet states set to 0x%02x", e.outlets)
+		return nil, 0
+	}
+	return nil, errorNotSupport
+}
+
+func (e *Emulator) spState() byte {
+	return boolByte(e.power) | boolByte(e.nightlight)<<1
+}
+
+func toBCD(v int) byte {
+	return byte(v/10<<4 | v%10)
+}
+
+// response builds an encrypted response to the request in packet.
+func (e *Emulator) response(packet []byte, command byte, errorCode int, key, payload []byte) ([]byte, error) {
+	if rem := len(payload) % 16; rem != 0 {
+		payload = append(payload, make([]byte, 16-rem)...)
+	}
+	encrypted, err := encrypt(key, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, 0x38+len(encrypted))
+	copy(resp, packet[:0x08])
+	resp[0x22] = byte(errorCode & 0xff)
+	resp[0x23] = byte((errorCode >> 8) & 0xff)
+	resp[0x24] = byte(e.cfg.DeviceType & 0xff)
+	resp[0x25] = byte(e.cfg.DeviceType >> 8)
+	resp[0x26] = command
+	resp[0x28] = packet[0x28]
+	resp[0x29] = packet[0x29]
+	for i := 0; i < 6; i++ {
+		resp[0x2a+i] = e.cfg.MAC[5-i]
+	}
+	copy(resp[0x30:0x34], packet[0x30:0x34])
+	sum := checksum(payload)
+	resp[0x34] = byte(sum & 0xff)
+	resp[0x35] = byte(sum >> 8)
+	copy(resp[0x38:], encrypted)
+	setChecksum(resp)
+	return resp, nil
+}
+
+// trimCode strips the padding off an IR or RF code using the length field in
+// bytes 2 and 3.
+func trimCode(data []byte) []byte {
+	if len(data) < 4 {
+		return append([]byte{}, data...)
+	}
+	l := 4 + (int(data[2]) | int(data[3])<<8)
+	if l > len(data) {
+		l = len(data)
+	}
+	return append([]byte{}, data[:l]...)
+}
+
+func encrypt(key, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create new AES cipher: %v", err)
+	}
+	out := make([]byte, len(payload))
+	cipher.NewCBCEncrypter(block, defaultIV).CryptBlocks(out, payload)
+	return out, nil
+}
+
+func decrypt(key, payload []byte) ([]byte, error) {
+	if len(payload) == 0 || len(payload)%16 != 0 {
+		return nil, fmt.Errorf("encrypted payload has an invalid length of %v", len(payload))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating new decryption cipher: %v", err)
+	}
+	out := make([]byte, len(payload))
+	cipher.NewCBCDecrypter(block, defaultIV).CryptBlocks(out, payload)
+	return out, nil
+}
+
+func checksum(p []byte) int {
+	sum := 0xbeaf
+	for _, v := range p {
+		sum += int(v)
+	}
+	return sum & 0xffff
+}
+
+func validChecksum(packet []byte) bool {
+	expected := int(packet[0x20]) | int(packet[0x21])<<8
+	tmp := append([]byte{}, packet...)
+	tmp[0x20] = 0
+	tmp[0x21] = 0
+	return checksum(tmp) == expected
+}
+
+func setChecksum(packet []byte) {
+	packet[0x20] = 0
+	packet[0x21] = 0
+	sum := checksum(packet)
+	packet[0x20] = byte(sum & 0xff)
+	packet[0x21] = byte(sum >> 8)
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package broadlinkrm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors that can be checked with errors.Is. Most of them are wrapped in an
+// error that describes the device and the operation.
+var (
+	// ErrTimeout means the device did not answer a request, even after
+	// it was resent.
+	ErrTimeout = errors.New("timed out")
+
+	// ErrLearnTimeout means no code was received while the device was in
+	// learning mode.
+	ErrLearnTimeout = errors.New("learning timeout")
+
+	// ErrAuthFailed means the device rejected the authentication request
+	// or the session key.
+	ErrAuthFailed = errors.New("authentication failed")
+
+	// ErrUnsupported means the device is not capable of the operation.
+	ErrUnsupported = errors.New("operation not supported by device")
+
+	// ErrUnknownDevice means no device matches the given IP or MAC
+	// address.
+	ErrUnknownDevice = errors.New("unknown device")
+
+	// ErrNoDevices means no devices have been discovered or added.
+	ErrNoDevices = errors.New("no devices")
+)
+
+// errorCodeMeanings describes the error codes that devices place at 0x22 of
+// their responses. Based on the exceptions in
+// https://github.com/mjg59/python-broadlink
+var errorCodeMeanings = map[int]string{
+	-1:    "authentication failed",
+	-2:    "you have been logged out",
+	-3:    "the device is offline",
+	-4:    "command not supported",
+	-5:    "the device storage is full",
+	-6:    "structure is abnormal",
+	-7:    "control key is expired",
+	-8:    "send error",
+	-9:    "write error",
+	-10:   "read error",
+	-11:   "SSID could not be found in AP configuration",
+	-4012: "failed to verify user authority",
+}
+
+// DeviceCodeError is returned when a device answers a request with a non-zero
+// error code. Codes -1, -2, -7 and -4012 match ErrAuthFailed, and code -4
+// matches ErrUnsupported.
+type DeviceCodeError struct {
+	Code int
+}
+
+func (e *DeviceCodeError) Error() string {
+	return fmt.Sprintf("device responded with error code %d (%v)", e.Code, e.Meaning())
+}
+
+// Meaning returns a description of the error code.
+func (e *DeviceCodeError) Meaning() string {
+	if m, ok := errorCodeMeanings[e.Code]; ok {
+		return m
+	}
+	return "unknown error"
+}
+
+// Is lets errors.Is match the error codes that have a sentinel error.
+func (e *DeviceCodeError) Is(target error) bool {
+	switch target {
+	case ErrAuthFailed:
+		return e.Code == -1 || e.Code == -2 || e.Code == -7 || e.Code == -4012
+	case ErrUnsupported:
+		return e.Code == -4
+	}
+	return false
+}
+
+// unsupportedError keeps the message that describes why a device cannot do
+// something while matching ErrUnsupported.
+type unsupportedError struct {
+	msg string
+}
+
+func (e *unsupportedError) Error() string {
+	return e.msg
+}
+
+func (e *unsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+func unsupportedf(format string, a ...interface{}) error {
+	return &unsupportedError{msg: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,97 @@
+package broadlinkrm
+
+import (
+	"time"
+)
+
+const eventBufferSize = 16
+
+// EventType identifies the kind of Event.
+type EventType int
+
+// Enumerations of EventType.
+const (
+	// AddressChanged means a known device answered discovery from a new IP
+	// address, e.g. because its DHCP lease changed.
+	AddressChanged EventType = iota
+
+	// DeviceOnline means a device answered after being offline, or answered
+	// for the first time.
+	DeviceOnline
+
+	// DeviceOffline means a device failed to answer several requests in a
+	// row.
+	DeviceOffline
+
+	// AlarmSensorChanged means a sensor paired with an S1 hub changed state.
+	AlarmSensorChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case AddressChanged:
+		return "address changed"
+	case DeviceOnline:
+		return "online"
+	case DeviceOffline:
+		return "offline"
+	case AlarmSensorChanged:
+		return "alarm sensor changed"
+	}
+	return "unknown event"
+}
+
+// Event describes something that happened to a device.
+type Event struct {
+	Type EventType
+	Time time.Time
+	MAC  string
+	IP   string
+
+	// PreviousIP is set for AddressChanged events.
+	PreviousIP string
+
+	// Reauthenticated is true if the device had to be re-authenticated
+	// because it rejected its credentials.
+	Reauthenticated bool
+
+	// Sensor and PreviousState are set for AlarmSensorChanged events.
+	Sensor        AlarmSensor
+	PreviousState AlarmSensorState
+}
+
+// Subscribe returns a channel that receives events for all devices. Events
+// are dropped if the channel's buffer is full. Call the returned function to
+// unsubscribe - the channel is closed afterwards.
+func (b *Broadlink) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	b.eventsMu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.eventsMu.Unlock()
+
+	return ch, func() {
+		b.eventsMu.Lock()
+		defer b.eventsMu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Broadlink) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.eventsMu.Lock()
+	defer b.eventsMu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package broadlinkrm
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// offlineAfterFailures is the number of consecutive failed requests after
+// which a device is considered to be offline.
+const offlineAfterFailures = 2
+
+// DeviceStatus describes the health of a device.
+type DeviceStatus struct {
+	IP         string
+	MAC        string
+	DeviceType int
+	Model      string
+	Name       string // see DeviceInfo
+
+	// Online is false until the device has answered a request, and after
+	// it has failed to answer several requests in a row.
+	Online bool
+
+	// LastSeen is the time of the last response from the device.
+	LastSeen time.Time
+
+	// ConsecutiveFailures is the number of requests in a row that the
+	// device has not answered.
+	ConsecutiveFailures int
+
+	// Latency is the round-trip time of the last response.
+	Latency time.Duration
+}
+
+type deviceHealth struct {
+	online   bool
+	lastSeen time.Time
+	failures int
+	latency  time.Duration
+}
+
+// Status returns the health of all devices.
+func (b *Broadlink) Status() []DeviceStatus {
+	b.mu.RLock()
+	devices := make([]*device, len(b.devices))
+	copy(devices, b.devices)
+	b.mu.RUnlock()
+
+	resp := make([]DeviceStatus, 0, len(devices))
+	for _, d := range devices {
+		resp = append(resp, d.status())
+	}
+	return resp
+}
+
+// StartHealthMonitor probes every device in the background at each interval
+// until ctx is done. Devices that are busy with another request are skipped,
+// as that request updates their health anyway. Subscribers receive
+// DeviceOnline and DeviceOffline events when a device changes state.
+func (b *Broadlink) StartHealthMonitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				b.probeDevices(ctx)
+			}
+		}
+	}()
+}
+
+func (b *Broadlink) probeDevices(ctx context.Context) {
+	b.mu.RLock()
+	devices := make([]*device, len(b.devices))
+	copy(devices, b.devices)
+	b.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, d := range devices {
+		req, ok := probePayload(d.family())
+		if !ok || !d.tryAcquire() {
+			continue
+		}
+		wg.Add(1)
+		go func(d *device) {
+			defer wg.Done()
+			defer d.release()
+			if _, err := d.serverRequest(ctx, req); err != nil && ctx.Err() == nil {
+				log.Printf("Health check of device %v at %v failed: %v", d.mac.String(), d.address(), err)
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+// watchHealth publishes an event whenever d goes online or offline. It must
+// be called before d is shared.
+func (b *Broadlink) watchHealth(d *device) {
+	d.onHealthChange = func(online bool) {
+		e := Event{
+			Type: DeviceOffline,
+			MAC:  d.mac.String(),
+			IP:   d.address(),
+		}
+		if online {
+			e.Type = DeviceOnline
+		}
+		log.Printf("Device %v at %v is %v", e.MAC, e.IP, e.Type)
+		b.publish(e)
+	}
+}
+
+func (d *device) status() DeviceStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DeviceStatus{
+		IP:                  d.remoteAddr,
+		MAC:                 d.mac.String(),
+		DeviceType:          d.deviceType,
+		Model:               isKnownDevice(d.deviceType).name,
+		Name:                d.info.name,
+		Online:              d.health.online,
+		LastSeen:            d.health.lastSeen,
+		ConsecutiveFailures: d.health.failures,
+		Latency:             d.health.latency,
+	}
+}
+
+// recordResponse is called whenever the device answers a request.
+func (d *device) recordResponse(latency time.Duration) {
+	d.mu.Lock()
+	changed := !d.health.online
+	d.health.online = true
+	d.health.lastSeen = time.Now()
+	d.health.failures = 0
+	d.health.latency = latency
+	d.mu.Unlock()
+
+	if changed && d.onHealthChange != nil {
+		d.onHealthChange(true)
+	}
+}
+
+// recordFailure is called whenever the device does not answer a request.
+func (d *device) recordFailure() {
+	d.mu.Lock()
+	d.health.failures++
+	changed := d.health.online && d.health.failures >= offlineAfterFailures
+	if changed {
+		d.health.online = false
+	}
+	d.mu.Unlock()
+
+	if changed && d.onHealthChange != nil {
+		d.onHealthChange(false)
+	}
+}
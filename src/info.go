@@ -0,0 +1,189 @@
+package broadlinkrm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+)
+
+// maxNameLength is the longest name that fits between the start of the name
+// at 0x04 and the lock flag at 0x43 of a set name packet.
+const maxNameLength = 0x43 - 0x04
+
+// DeviceInfo describes a device as it was set up in the vendor app.
+type DeviceInfo struct {
+	// Name, Locked and Cloud are taken from the device's last answer to
+	// discovery, and are empty for devices that were added manually until
+	// they are discovered or renamed.
+	Name   string
+	Locked bool // the device only accepts authentication from the app that set it up
+	Cloud  bool // the device is registered with the vendor's cloud
+
+	Firmware int
+}
+
+// deviceInfo holds the fields of DeviceInfo that are reported during
+// discovery.
+type deviceInfo struct {
+	name   string
+	locked bool
+	cloud  bool
+}
+
+// GetDeviceInfo queries the firmware version of a device and returns it along
+// with the name and flags reported during discovery. If id is an empty string
+// it selects the first device.
+func (b *Broadlink) GetDeviceInfo(id string) (DeviceInfo, error) {
+	return b.GetDeviceInfoContext(context.Background(), id)
+}
+
+// GetDeviceInfoContext is like GetDeviceInfo but gives up as soon as ctx is
+// done.
+func (b *Broadlink) GetDeviceInfoContext(ctx context.Context, id string) (DeviceInfo, error) {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	if err := d.acquire(ctx); err != nil {
+		return DeviceInfo{}, err
+	}
+	defer d.release()
+
+	firmware, err := d.getFirmware(ctx)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	info := d.getInfo()
+	return DeviceInfo{
+		Name:     info.name,
+		Locked:   info.locked,
+		Cloud:    info.cloud,
+		Firmware: firmware,
+	}, nil
+}
+
+// SetDeviceName renames a device. The name is limited to 63 bytes. If id is
+// an empty string it selects the first device.
+func (b *Broadlink) SetDeviceName(id, name string) error {
+	return b.SetDeviceNameContext(context.Background(), id, name)
+}
+
+// SetDeviceNameContext is like SetDeviceName but gives up as soon as ctx is
+// done.
+func (b *Broadlink) SetDeviceNameContext(ctx context.Context, id, name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name has a length of %v bytes - it should not be longer than %v bytes", len(name), maxNameLength)
+	}
+	return b.updateInfo(ctx, id, func(info *deviceInfo) {
+		info.name = name
+	})
+}
+
+// SetDeviceLock sets or clears the lock flag of a device. A locked device
+// only accepts authentication from the app that set it up, so unlock a device
+// before adding it to this library. If id is an empty string it selects the
+// first device.
+func (b *Broadlink) SetDeviceLock(id string, locked bool) error {
+	return b.SetDeviceLockContext(context.Background(), id, locked)
+}
+
+// SetDeviceLockContext is like SetDeviceLock but gives up as soon as ctx is
+// done.
+func (b *Broadlink) SetDeviceLockContext(ctx context.Context, id string, locked bool) error {
+	return b.updateInfo(ctx, id, func(info *deviceInfo) {
+		info.locked = locked
+	})
+}
+
+// updateInfo applies change to the name and lock flag of the device and sends
+// both to the device, since they are always set together.
+func (b *Broadlink) updateInfo(ctx context.Context, id string, change func(*deviceInfo)) error {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return err
+	}
+	if err := d.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.release()
+
+	info := d.getInfo()
+	change(&info)
+	resp, err := d.serverRequest(ctx, setInfoPayload(info))
+	if err != nil {
+		return fmt.Errorf("error while making server request to set device name: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return resp.deviceError()
+	}
+	d.setInfo(info)
+	log.Printf("Device %v is now named %v, locked: %v", d.mac.String(), info.name, info.locked)
+	return nil
+}
+
+func (d *device) getFirmware(ctx context.Context) (int, error) {
+	resp, err := d.serverRequest(ctx, getFirmwarePayload())
+	if err != nil {
+		return 0, fmt.Errorf("error while making server request to get firmware version: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return 0, resp.deviceError()
+	}
+	if resp.Type != CommandOK || len(resp.Data) < 6 {
+		return 0, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
+	}
+	return int(resp.Data[4]) | int(resp.Data[5])<<8, nil
+}
+
+func (d *device) getInfo() deviceInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.info
+}
+
+func (d *device) setInfo(info deviceInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.info = info
+}
+
+// parseDeviceInfo extracts the name and flags from a discovery response. The
+// name starts at 0x40 and is zero-terminated, and the flags are the last 2
+// bytes of the 0x80-byte response.
+func parseDeviceInfo(buf []byte) deviceInfo {
+	info := deviceInfo{}
+	if len(buf) <= 0x40 {
+		return info
+	}
+	name := buf[0x40:]
+	if len(buf) >= 0x80 {
+		name = buf[0x40:0x7e]
+		info.cloud = buf[0x7e] != 0
+		info.locked = buf[0x7f] != 0
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	info.name = string(name)
+	return info
+}
+
+func getFirmwarePayload() unencryptedRequest {
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: basicRequestPayload(0x68),
+		raw:     true,
+	}
+}
+
+func setInfoPayload(info deviceInfo) unencryptedRequest {
+	p := make([]byte, 0x50, 0x50)
+	copy(p[0x04:0x43], info.name)
+	p[0x43] = boolToByte(info.locked)
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: p,
+		raw:     true,
+	}
+}
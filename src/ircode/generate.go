@@ -0,0 +1,246 @@
+package ircode
+
+import (
+	"fmt"
+)
+
+// Time from the start of one frame to the start of the next in microseconds.
+// The space after the last frame is as long as the space between frames.
+const (
+	necPeriod     = 108000
+	samsungPeriod = 108000
+	sonyPeriod    = 45000
+	rc5Period     = 113778
+	rc6Period     = 106667
+)
+
+// Generate builds an IR code from the protocol, address and command of d, so
+// that a code can be sent without learning it first. It also uses Bits for
+// Sony codes (12 if it is 0), Extended for 20-bit Sony codes and Toggle for
+// RC5 and RC6 codes. Repeats is the number of frames that follow the first
+// one, which are NEC repeat codes for NEC and copies of the first frame for
+// the other protocols.
+//
+// A 16-bit Samsung address whose two bytes are equal, or an extended NEC
+// address whose high byte is the inverse of its low byte, is the same as its
+// low byte on its own. Both generate the same code, and Identify reports the
+// 8-bit address.
+func Generate(d Decoded) (Code, error) {
+	if d.Repeats < 0 {
+		return Code{}, fmt.Errorf("repeat count %v should not be negative", d.Repeats)
+	}
+
+	var frame []int
+	var err error
+	period := 0
+	switch d.Protocol {
+	case NEC:
+		frame, err = generateNEC(d)
+		period = necPeriod
+	case Samsung:
+		frame, err = generateSamsung(d)
+		period = samsungPeriod
+	case Sony:
+		frame, err = generateSony(d)
+		period = sonyPeriod
+	case RC5:
+		frame, err = generateRC5(d)
+		period = rc5Period
+	case RC6:
+		frame, err = generateRC6(d)
+		period = rc6Period
+	default:
+		return Code{}, fmt.Errorf("cannot generate a code for protocol %v", d.Protocol)
+	}
+	if err != nil {
+		return Code{}, err
+	}
+
+	repeat := frame
+	if d.Protocol == NEC {
+		repeat = []int{necLeaderPulse, necRepeatSpace, pulseDistanceMark}
+	}
+	pulses := appendFrame(nil, frame, period)
+	for i := 0; i < d.Repeats; i++ {
+		pulses = appendFrame(pulses, repeat, period)
+	}
+	return Code{Type: IR, Pulses: pulses}, nil
+}
+
+// appendFrame appends frame to pulses, followed by the space that fills the
+// rest of the period.
+func appendFrame(pulses, frame []int, period int) []int {
+	length := 0
+	for _, d := range frame {
+		length += d
+	}
+	gap := period - length
+	if gap < frameGap {
+		gap = frameGap
+	}
+	pulses = append(pulses, frame...)
+	return append(pulses, gap)
+}
+
+func checkRange(name string, v, max int) error {
+	if v < 0 || v > max {
+		return fmt.Errorf("%v %d is out of range - expected 0 to %d", name, v, max)
+	}
+	return nil
+}
+
+// pulseDistanceFrame is the inverse of pulseDistance.
+func pulseDistanceFrame(leaderPulse, leaderSpace int, v uint64, bits int) []int {
+	frame := []int{leaderPulse, leaderSpace}
+	for i := 0; i < bits; i++ {
+		space := pulseDistanceZero
+		if v&(1<<uint(i)) != 0 {
+			space = pulseDistanceOne
+		}
+		frame = append(frame, pulseDistanceMark, space)
+	}
+	return append(frame, pulseDistanceMark)
+}
+
+func generateNEC(d Decoded) ([]int, error) {
+	if err := checkRange("address", d.Address, 0xffff); err != nil {
+		return nil, err
+	}
+	if err := checkRange("command", d.Command, 0xff); err != nil {
+		return nil, err
+	}
+	address := uint64(d.Address)
+	if d.Address <= 0xff {
+		address |= uint64(d.Address^0xff) << 8
+	}
+	v := address | uint64(d.Command)<<16 | uint64(d.Command^0xff)<<24
+	return pulseDistanceFrame(necLeaderPulse, necLeaderSpace, v, 32), nil
+}
+
+func generateSamsung(d Decoded) ([]int, error) {
+	if err := checkRange("address", d.Address, 0xffff); err != nil {
+		return nil, err
+	}
+	if err := checkRange("command", d.Command, 0xff); err != nil {
+		return nil, err
+	}
+	address := uint64(d.Address)
+	if d.Address <= 0xff {
+		address |= uint64(d.Address) << 8
+	}
+	v := address | uint64(d.Command)<<16 | uint64(d.Command^0xff)<<24
+	return pulseDistanceFrame(samsungLeaderPulse, samsungLeaderSpace, v, 32), nil
+}
+
+func generateSony(d Decoded) ([]int, error) {
+	bits := d.Bits
+	if bits == 0 {
+		bits = 12
+	}
+	if err := checkRange("command", d.Command, 0x7f); err != nil {
+		return nil, err
+	}
+	v := d.Command
+	switch bits {
+	case 12:
+		if err := checkRange("address", d.Address, 0x1f); err != nil {
+			return nil, err
+		}
+		v |= d.Address << 7
+	case 15:
+		if err := checkRange("address", d.Address, 0xff); err != nil {
+			return nil, err
+		}
+		v |= d.Address << 7
+	case 20:
+		if err := checkRange("address", d.Address, 0x1f); err != nil {
+			return nil, err
+		}
+		if err := checkRange("extended byte", d.Extended, 0xff); err != nil {
+			return nil, err
+		}
+		v |= d.Address<<7 | d.Extended<<12
+	default:
+		return nil, fmt.Errorf("Sony codes have 12, 15 or 20 bits - got %v", bits)
+	}
+
+	frame := []int{sonyLeaderPulse, sonyUnit}
+	for i := 0; i < bits; i++ {
+		pulse := sonyUnit
+		if v&(1<<uint(i)) != 0 {
+			pulse = 2 * sonyUnit
+		}
+		frame = append(frame, pulse, sonyUnit)
+	}
+	// The last pulse is followed by the space between frames.
+	return frame[:len(frame)-1], nil
+}
+
+// appendManchester appends the levels of the lowest bits of v, most
+// significant bit first. one is the level of the first half of a 1.
+func appendManchester(lv []bool, v, bits int, one bool) []bool {
+	for i := bits - 1; i >= 0; i-- {
+		first := !one
+		if v&(1<<uint(i)) != 0 {
+			first = one
+		}
+		lv = append(lv, first, !first)
+	}
+	return lv
+}
+
+// fromLevels is the inverse of levels. Leading and trailing spaces are
+// dropped, since they cannot be told apart from the space between frames.
+func fromLevels(lv []bool, unit int) []int {
+	for len(lv) > 0 && !lv[0] {
+		lv = lv[1:]
+	}
+	for len(lv) > 0 && !lv[len(lv)-1] {
+		lv = lv[:len(lv)-1]
+	}
+	frame := []int{}
+	for i := 0; i < len(lv); {
+		j := i
+		for j < len(lv) && lv[j] == lv[i] {
+			j++
+		}
+		frame = append(frame, (j-i)*unit)
+		i = j
+	}
+	return frame
+}
+
+func generateRC5(d Decoded) ([]int, error) {
+	if err := checkRange("address", d.Address, 0x1f); err != nil {
+		return nil, err
+	}
+	if err := checkRange("command", d.Command, 0x7f); err != nil {
+		return nil, err
+	}
+	v := 1<<13 | d.Address<<6 | d.Command&0x3f
+	if d.Command&0x40 == 0 {
+		v |= 1 << 12
+	}
+	if d.Toggle {
+		v |= 1 << 11
+	}
+	return fromLevels(appendManchester(nil, v, 14, false), rc5HalfBit), nil
+}
+
+func generateRC6(d Decoded) ([]int, error) {
+	if err := checkRange("address", d.Address, 0xff); err != nil {
+		return nil, err
+	}
+	if err := checkRange("command", d.Command, 0xff); err != nil {
+		return nil, err
+	}
+	// start bit 1 and mode 0
+	lv := appendManchester(nil, 0x8, 4, true)
+	if d.Toggle {
+		lv = append(lv, true, true, false, false)
+	} else {
+		lv = append(lv, false, false, true, true)
+	}
+	lv = appendManchester(lv, d.Address<<8|d.Command, 16, true)
+	return append([]int{rc6LeaderPulse, rc6LeaderSpace}, fromLevels(lv, rc6Unit)...), nil
+}
@@ -0,0 +1,151 @@
+// Package ircode converts between the hex codes learned by Broadlink devices
+// and pulse timings in microseconds.
+//
+// A code starts with a 4-byte header: the type (0x26 for IR, 0xb2 for 433MHz
+// RF, 0xd7 for 315MHz RF), the number of times the device should repeat the
+// code, and the length of the timings as a little-endian number. Each timing is
+// a number of ticks of 269/8192 milliseconds (about 32.84µs). Timings that do
+// not fit in a byte are written as 0x00 followed by the timing as a 2-byte
+// big-endian number. The timings alternate between pulses and spaces, starting
+// with a pulse. Learned codes are usually padded with zeros after the timings.
+package ircode
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// Tick is the resolution of a timing in microseconds.
+const Tick = 269000.0 / 8192.0
+
+const (
+	headerLength = 4
+	maxTicks     = 0xffff
+)
+
+// Type tells a device how to transmit a code.
+type Type byte
+
+// Enumerations of Type.
+const (
+	IR    Type = 0x26
+	RF433 Type = 0xb2
+	RF315 Type = 0xd7
+)
+
+func (t Type) String() string {
+	switch t {
+	case IR:
+		return "ir"
+	case RF433:
+		return "rf433"
+	case RF315:
+		return "rf315"
+	}
+	return "unknown"
+}
+
+func (t Type) valid() error {
+	if t != IR && t != RF433 && t != RF315 {
+		return fmt.Errorf("0x%02x is not a valid code type - expected 0x%02x, 0x%02x or 0x%02x", byte(t), byte(IR), byte(RF433), byte(RF315))
+	}
+	return nil
+}
+
+// Code is a decoded Broadlink code.
+type Code struct {
+	Type   Type
+	Repeat int // number of extra times the code is sent
+
+	// Pulses holds the durations in microseconds, alternating between pulses
+	// and spaces and starting with a pulse.
+	Pulses []int
+}
+
+// Decode parses a code in the format learned by Broadlink devices.
+func Decode(data []byte) (Code, error) {
+	if len(data) < headerLength {
+		return Code{}, fmt.Errorf("code has a length of %v bytes - it should be at least %v bytes long", len(data), headerLength)
+	}
+	c := Code{
+		Type:   Type(data[0]),
+		Repeat: int(data[1]),
+	}
+	if err := c.Type.valid(); err != nil {
+		return Code{}, err
+	}
+	l := int(data[2]) | int(data[3])<<8
+	if headerLength+l > len(data) {
+		return Code{}, fmt.Errorf("code claims to have %v bytes of timings but only has %v", l, len(data)-headerLength)
+	}
+
+	timings := data[headerLength : headerLength+l]
+	c.Pulses = make([]int, 0, len(timings))
+	for i := 0; i < len(timings); i++ {
+		ticks := int(timings[i])
+		if ticks == 0 {
+			if i+2 >= len(timings) {
+				return Code{}, fmt.Errorf("extended timing at offset %v is truncated", headerLength+i)
+			}
+			ticks = int(timings[i+1])<<8 | int(timings[i+2])
+			i += 2
+		}
+		c.Pulses = append(c.Pulses, int(math.Round(float64(ticks)*Tick)))
+	}
+	return c, nil
+}
+
+// DecodeString is like Decode but takes the code as a hex string, in the
+// format returned by Learn.
+func DecodeString(s string) (Code, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return Code{}, fmt.Errorf("error converting %v to hex: %v", s, err)
+	}
+	return Decode(data)
+}
+
+// Encode converts c to the format sent by Broadlink devices. Durations are
+// rounded to the nearest tick.
+func Encode(c Code) ([]byte, error) {
+	if err := c.Type.valid(); err != nil {
+		return nil, err
+	}
+	if c.Repeat < 0 || c.Repeat > 0xff {
+		return nil, fmt.Errorf("repeat count %v is out of range - expected 0 to 255", c.Repeat)
+	}
+
+	data := make([]byte, headerLength, headerLength+len(c.Pulses))
+	data[0] = byte(c.Type)
+	data[1] = byte(c.Repeat)
+	for i, p := range c.Pulses {
+		ticks := int(math.Round(float64(p) / Tick))
+		if ticks < 1 || ticks > maxTicks {
+			return nil, fmt.Errorf("duration %vµs at position %v is out of range - expected %.0fµs to %.0fµs", p, i, Tick/2, maxTicks*Tick)
+		}
+		if ticks > 0xff {
+			data = append(data, 0, byte(ticks>>8), byte(ticks))
+			continue
+		}
+		data = append(data, byte(ticks))
+	}
+
+	l := len(data) - headerLength
+	if l > 0xffff {
+		return nil, fmt.Errorf("code has %v bytes of timings - it should not have more than %v", l, 0xffff)
+	}
+	data[2] = byte(l)
+	data[3] = byte(l >> 8)
+	return data, nil
+}
+
+// EncodeString is like Encode but returns the code as a hex string that can
+// be passed to Execute or placed in a commands file.
+func EncodeString(c Code) (string, error) {
+	data, err := Encode(c)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
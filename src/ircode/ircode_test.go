@@ -0,0 +1,230 @@
+package ircode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want Code
+	}{
+		{
+			name: "one tick is 269/8192 milliseconds",
+			code: "26000300" + "0102ff",
+			want: Code{Type: IR, Pulses: []int{33, 66, 8373}},
+		},
+		{
+			name: "repeat byte",
+			code: "26050100" + "10",
+			want: Code{Type: IR, Repeat: 5, Pulses: []int{525}},
+		},
+		{
+			name: "extended durations",
+			code: "b2000700" + "000100" + "10" + "001000",
+			want: Code{Type: RF433, Pulses: []int{8406, 525, 134500}},
+		},
+		{
+			name: "padding after the timings",
+			code: "d7000100" + "10" + "000000000000",
+			want: Code{Type: RF315, Pulses: []int{525}},
+		},
+		{
+			name: "no timings",
+			code: "26000000",
+			want: Code{Type: IR, Pulses: []int{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeString(tt.code)
+			if err != nil {
+				t.Fatalf("DecodeString(%v) returned %v", tt.code, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeString(%v) = %+v, expected %+v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStringErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"not hex", "26zz0000"},
+		{"short header", "260000"},
+		{"invalid type", "01000100" + "10"},
+		{"length beyond the data", "26000400" + "1010"},
+		{"truncated extended duration", "26000200" + "0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := DecodeString(tt.code); err == nil {
+				t.Errorf("DecodeString(%v) = %+v, expected an error", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	tests := []struct {
+		name string
+		code Code
+		want string
+	}{
+		{
+			name: "durations are rounded to the nearest tick",
+			code: Code{Type: IR, Pulses: []int{33, 70, 8370}},
+			want: "26000300" + "0102ff",
+		},
+		{
+			name: "repeat byte",
+			code: Code{Type: RF315, Repeat: 255, Pulses: []int{525}},
+			want: "d7ff0100" + "10",
+		},
+		{
+			name: "extended durations",
+			code: Code{Type: RF433, Pulses: []int{8406, 525, 134500}},
+			want: "b2000700" + "000100" + "10" + "001000",
+		},
+		{
+			name: "length field is little-endian",
+			code: Code{Type: IR, Pulses: repeated(33, 300)},
+			want: "26002c01" + strings.Repeat("01", 300),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeString(tt.code)
+			if err != nil {
+				t.Fatalf("EncodeString(%+v) returned %v", tt.code, err)
+			}
+			if got != tt.want {
+				t.Errorf("EncodeString(%+v) = %v, expected %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		code Code
+	}{
+		{"invalid type", Code{Type: 0x01, Pulses: []int{525}}},
+		{"negative repeat", Code{Type: IR, Repeat: -1, Pulses: []int{525}}},
+		{"repeat too large", Code{Type: IR, Repeat: 256, Pulses: []int{525}}},
+		{"duration too short", Code{Type: IR, Pulses: []int{10}}},
+		{"duration too long", Code{Type: IR, Pulses: []int{3000000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Encode(tt.code); err == nil {
+				t.Errorf("Encode(%+v) = %x, expected an error", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	code := "2600" + "0b00" + "1a0d" + "0001a2" + "1a" + "000f41" + "0d1a"
+	c, err := DecodeString(code)
+	if err != nil {
+		t.Fatalf("DecodeString(%v) returned %v", code, err)
+	}
+	got, err := EncodeString(c)
+	if err != nil {
+		t.Fatalf("EncodeString(%+v) returned %v", c, err)
+	}
+	if got != code {
+		t.Errorf("round trip of %v returned %v", code, got)
+	}
+}
+
+func repeated(d, n int) []int {
+	pulses := make([]int, n)
+	for i := range pulses {
+		pulses[i] = d
+	}
+	return pulses
+}
+
+func TestGenerateIdentify(t *testing.T) {
+	tests := []struct {
+		in   Decoded
+		want Decoded // if different from in
+	}{
+		{in: Decoded{Protocol: NEC, Address: 0x04, Command: 0x08}},
+		{in: Decoded{Protocol: NEC, Address: 0x04, Command: 0x08, Repeats: 2}},
+		{in: Decoded{Protocol: NEC, Address: 0x1234, Command: 0xff}},
+		{
+			in:   Decoded{Protocol: NEC, Address: 0xfb04, Command: 0x08},
+			want: Decoded{Protocol: NEC, Address: 0x04, Command: 0x08},
+		},
+		{in: Decoded{Protocol: Samsung, Address: 0x07, Command: 0x02}},
+		{in: Decoded{Protocol: Samsung, Address: 0x0e07, Command: 0x02, Repeats: 1}},
+		{
+			in:   Decoded{Protocol: Samsung, Address: 0x0e0e, Command: 0x02},
+			want: Decoded{Protocol: Samsung, Address: 0x0e, Command: 0x02},
+		},
+		{in: Decoded{Protocol: Sony, Address: 0x01, Command: 0x15, Bits: 12, Repeats: 2}},
+		{in: Decoded{Protocol: Sony, Address: 0xa4, Command: 0x7f, Bits: 15}},
+		{in: Decoded{Protocol: Sony, Address: 0x1a, Command: 0x3d, Extended: 0xe2, Bits: 20}},
+		{in: Decoded{Protocol: RC5, Address: 0x00, Command: 0x0c}},
+		{in: Decoded{Protocol: RC5, Address: 0x1f, Command: 0x7f, Toggle: true, Repeats: 1}},
+		{in: Decoded{Protocol: RC6, Address: 0x00, Command: 0x0c}},
+		{in: Decoded{Protocol: RC6, Address: 0xff, Command: 0xa5, Toggle: true, Repeats: 1}},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want.Protocol == Unknown {
+			want = tt.in
+		}
+		want.Repeats = tt.in.Repeats
+		t.Run(tt.in.String(), func(t *testing.T) {
+			c, err := Generate(tt.in)
+			if err != nil {
+				t.Fatalf("Generate(%+v) returned %v", tt.in, err)
+			}
+			// Go through the hex format so that durations are rounded to
+			// ticks, as they are when a generated code is sent.
+			s, err := EncodeString(c)
+			if err != nil {
+				t.Fatalf("EncodeString returned %v", err)
+			}
+			if c, err = DecodeString(s); err != nil {
+				t.Fatalf("DecodeString(%v) returned %v", s, err)
+			}
+			got := Identify(c)
+			if got.Protocol != want.Protocol || got.Address != want.Address || got.Command != want.Command ||
+				got.Extended != want.Extended || got.Toggle != want.Toggle || got.Repeats != want.Repeats ||
+				(want.Protocol == Sony && got.Bits != want.Bits) {
+				t.Errorf("Identify returned %+v, expected %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []Decoded{
+		{Protocol: Unknown},
+		{Protocol: NEC, Command: 0x100},
+		{Protocol: NEC, Address: 0x10000},
+		{Protocol: Samsung, Command: -1},
+		{Protocol: Sony, Bits: 16},
+		{Protocol: Sony, Address: 0x20},
+		{Protocol: RC5, Command: 0x80},
+		{Protocol: RC6, Address: 0x100},
+		{Protocol: NEC, Repeats: -1},
+	}
+	for _, d := range tests {
+		if c, err := Generate(d); err == nil {
+			t.Errorf("Generate(%+v) = %+v, expected an error", d, c)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package ircode
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Timings of the supported protocols in microseconds. Based on
+// https://www.sbprojects.net/knowledge/ir/
+const (
+	necLeaderPulse     = 9000
+	necLeaderSpace     = 4500
+	necRepeatSpace     = 2250
+	samsungLeaderPulse = 4500
+	samsungLeaderSpace = 4500
+	pulseDistanceMark  = 560
+	pulseDistanceZero  = 560
+	pulseDistanceOne   = 1690
+
+	sonyLeaderPulse = 2400
+	sonyUnit        = 600
+
+	rc5HalfBit = 889
+
+	rc6LeaderPulse = 2666
+	rc6LeaderSpace = 889
+	rc6Unit        = 444
+
+	// frameGap is the shortest space that separates two frames. It is
+	// longer than any space within a frame of the supported protocols.
+	frameGap = 8000
+
+	// tolerance is how far a duration may be from the expected one, as a
+	// fraction of the expected duration.
+	tolerance = 0.3
+)
+
+// Protocol is a consumer IR protocol.
+type Protocol int
+
+// Enumerations of Protocol.
+const (
+	Unknown Protocol = iota
+	NEC              // NEC and extended NEC with a 16-bit address
+	Samsung
+	Sony // SIRC with 12, 15 or 20 bits
+	RC5
+	RC6 // RC6 mode 0
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case NEC:
+		return "NEC"
+	case Samsung:
+		return "Samsung"
+	case Sony:
+		return "Sony"
+	case RC5:
+		return "RC5"
+	case RC6:
+		return "RC6"
+	}
+	return "unknown"
+}
+
+// ParseProtocol is the inverse of Protocol.String. It ignores case.
+func ParseProtocol(s string) (Protocol, error) {
+	for p := NEC; p <= RC6; p++ {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return Unknown, fmt.Errorf("%v is not a valid protocol - expected nec, samsung, sony, rc5 or rc6", s)
+}
+
+// Decoded is the result of Identify.
+type Decoded struct {
+	Protocol Protocol
+	Address  int
+	Command  int
+	Extended int  // the extended byte of a 20-bit Sony code
+	Toggle   bool // the toggle bit of RC5 and RC6, which flips with every key press
+	Bits     int  // the number of data bits in a frame
+	Repeats  int  // the number of repeat frames after the first frame
+
+	// Summary describes the timings of codes that were not recognized.
+	Summary string
+}
+
+func (d Decoded) String() string {
+	switch d.Protocol {
+	case Unknown:
+		return "unrecognized: " + d.Summary
+	case Sony:
+		s := fmt.Sprintf("%v%d addr=0x%02x cmd=0x%02x", d.Protocol, d.Bits, d.Address, d.Command)
+		if d.Bits == 20 {
+			s += fmt.Sprintf(" ext=0x%02x", d.Extended)
+		}
+		return s
+	}
+	return fmt.Sprintf("%v addr=0x%02x cmd=0x%02x", d.Protocol, d.Address, d.Command)
+}
+
+// decoder recognizes a single frame of a protocol.
+type decoder func(frame []int) (Decoded, bool)
+
+var decoders = []decoder{
+	decodeNEC,
+	decodeSamsung,
+	decodeSony,
+	decodeRC5,
+	decodeRC6,
+}
+
+// Identify recognizes the protocol of a code from its first frame. Frames
+// after the first are counted as repeats if they carry the same data or are
+// NEC repeat codes.
+func Identify(c Code) Decoded {
+	frames := splitFrames(c.Pulses)
+	if len(frames) > 0 {
+		for _, decode := range decoders {
+			d, ok := decode(frames[0])
+			if !ok {
+				continue
+			}
+			for _, f := range frames[1:] {
+				if d.Protocol == NEC && isNECRepeat(f) {
+					d.Repeats++
+					continue
+				}
+				if r, ok := decode(f); ok && r.Address == d.Address && r.Command == d.Command {
+					d.Repeats++
+				}
+			}
+			return d
+		}
+	}
+	return Decoded{Summary: summarize(c.Pulses, len(frames))}
+}
+
+// splitFrames splits pulses at every space that is at least frameGap long.
+// The spaces that separate the frames are dropped, so every frame ends with a
+// pulse.
+func splitFrames(pulses []int) [][]int {
+	frames := [][]int{}
+	start := 0
+	for i := 1; i < len(pulses); i += 2 {
+		if pulses[i] >= frameGap {
+			frames = append(frames, pulses[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(pulses) {
+		end := len(pulses)
+		if end%2 == 0 {
+			// drop the trailing space
+			end--
+		}
+		if end > start {
+			frames = append(frames, pulses[start:end])
+		}
+	}
+	return frames
+}
+
+func near(d int, expected float64) bool {
+	return math.Abs(float64(d)-expected) <= expected*tolerance
+}
+
+// pulseDistance decodes a frame that starts with a leader and encodes each
+// bit in the length of the space after a pulse, least significant bit first.
+func pulseDistance(frame []int, leaderPulse, leaderSpace float64, bits int) (uint64, bool) {
+	if len(frame) != 2+2*bits+1 || !near(frame[0], leaderPulse) || !near(frame[1], leaderSpace) {
+		return 0, false
+	}
+	var v uint64
+	for i := 0; i < bits; i++ {
+		if !near(frame[2+2*i], pulseDistanceMark) {
+			return 0, false
+		}
+		space := frame[3+2*i]
+		switch {
+		case near(space, pulseDistanceOne):
+			v |= 1 << uint(i)
+		case !near(space, pulseDistanceZero):
+			return 0, false
+		}
+	}
+	if !near(frame[len(frame)-1], pulseDistanceMark) {
+		return 0, false
+	}
+	return v, true
+}
+
+func decodeNEC(frame []int) (Decoded, bool) {
+	v, ok := pulseDistance(frame, necLeaderPulse, necLeaderSpace, 32)
+	if !ok {
+		return Decoded{}, false
+	}
+	command := int(v>>16) & 0xff
+	if int(v>>24)&0xff != command^0xff {
+		return Decoded{}, false
+	}
+	address := int(v) & 0xff
+	if inverse := int(v>>8) & 0xff; inverse != address^0xff {
+		// extended NEC
+		address |= inverse << 8
+	}
+	return Decoded{Protocol: NEC, Address: address, Command: command, Bits: 32}, true
+}
+
+func isNECRepeat(frame []int) bool {
+	return len(frame) == 3 && near(frame[0], necLeaderPulse) && near(frame[1], necRepeatSpace) && near(frame[2], pulseDistanceMark)
+}
+
+func decodeSamsung(frame []int) (Decoded, bool) {
+	v, ok := pulseDistance(frame, samsungLeaderPulse, samsungLeaderSpace, 32)
+	if !ok {
+		return Decoded{}, false
+	}
+	command := int(v>>16) & 0xff
+	if int(v>>24)&0xff != command^0xff {
+		return Decoded{}, false
+	}
+	address := int(v) & 0xff
+	if second := int(v>>8) & 0xff; second != address {
+		address |= second << 8
+	}
+	return Decoded{Protocol: Samsung, Address: address, Command: command, Bits: 32}, true
+}
+
+// decodeSony decodes SIRC, which encodes each bit in the length of a pulse,
+// least significant bit first. The last pulse of a frame is not followed by a
+// space.
+func decodeSony(frame []int) (Decoded, bool) {
+	if len(frame) < 3 || len(frame)%2 == 0 || !near(frame[0], sonyLeaderPulse) || !near(frame[1], sonyUnit) {
+		return Decoded{}, false
+	}
+	bits := (len(frame) - 1) / 2
+	if bits != 12 && bits != 15 && bits != 20 {
+		return Decoded{}, false
+	}
+	v := 0
+	for i := 0; i < bits; i++ {
+		pulse := frame[2+2*i]
+		switch {
+		case near(pulse, 2*sonyUnit):
+			v |= 1 << uint(i)
+		case !near(pulse, sonyUnit):
+			return Decoded{}, false
+		}
+		if i < bits-1 && !near(frame[3+2*i], sonyUnit) {
+			return Decoded{}, false
+		}
+	}
+	d := Decoded{Protocol: Sony, Command: v & 0x7f, Bits: bits}
+	switch bits {
+	case 15:
+		d.Address = (v >> 7) & 0xff
+	default:
+		d.Address = (v >> 7) & 0x1f
+		d.Extended = (v >> 12) & 0xff
+	}
+	return d, true
+}
+
+// levels expands durations into one level per unit, starting with a pulse. It
+// fails if a duration is not close to a whole number of units between 1 and
+// maxUnits.
+func levels(frame []int, unit float64, maxUnits int) ([]bool, bool) {
+	lv := []bool{}
+	for i, d := range frame {
+		n := int(math.Round(float64(d) / unit))
+		if n < 1 || n > maxUnits || !near(d, float64(n)*unit) {
+			return nil, false
+		}
+		for j := 0; j < n; j++ {
+			lv = append(lv, i%2 == 0)
+		}
+	}
+	return lv, true
+}
+
+// manchester reads bits from pairs of levels, most significant bit first. one
+// is the level of the first half of a 1.
+func manchester(lv []bool, one bool) (int, bool) {
+	v := 0
+	for i := 0; i+1 < len(lv); i += 2 {
+		if lv[i] == lv[i+1] {
+			return 0, false
+		}
+		v <<= 1
+		if lv[i] == one {
+			v |= 1
+		}
+	}
+	return v, true
+}
+
+// decodeRC5 decodes RC5, a Manchester code in which a 1 is a space followed by
+// a pulse. A frame has 2 start bits, a toggle bit, 5 address bits and 6
+// command bits. The second start bit is the inverted seventh command bit of
+// RC5X.
+func decodeRC5(frame []int) (Decoded, bool) {
+	lv, ok := levels(frame, rc5HalfBit, 2)
+	if !ok {
+		return Decoded{}, false
+	}
+	// The first half of the first start bit is a space, which cannot be
+	// seen, and so is the second half of the last bit if it is a 0.
+	lv = append([]bool{false}, lv...)
+	if len(lv)%2 == 1 {
+		lv = append(lv, false)
+	}
+	if len(lv) != 28 {
+		return Decoded{}, false
+	}
+	v, ok := manchester(lv, false)
+	if !ok || v>>13 != 1 {
+		return Decoded{}, false
+	}
+	command := v & 0x3f
+	if v&(1<<12) == 0 {
+		command |= 0x40
+	}
+	return Decoded{
+		Protocol: RC5,
+		Address:  (v >> 6) & 0x1f,
+		Command:  command,
+		Toggle:   v&(1<<11) != 0,
+		Bits:     14,
+	}, true
+}
+
+// decodeRC6 decodes RC6 mode 0, a Manchester code in which a 1 is a pulse
+// followed by a space. After the leader a frame has a start bit, 3 mode bits,
+// a toggle bit of double length, 8 address bits and 8 command bits.
+func decodeRC6(frame []int) (Decoded, bool) {
+	if len(frame) < 3 || !near(frame[0], rc6LeaderPulse) || !near(frame[1], rc6LeaderSpace) {
+		return Decoded{}, false
+	}
+	lv, ok := levels(frame[2:], rc6Unit, 3)
+	if !ok {
+		return Decoded{}, false
+	}
+	// The last space cannot be seen if the last bit is a 1.
+	if len(lv) == 43 {
+		lv = append(lv, false)
+	}
+	if len(lv) != 44 {
+		return Decoded{}, false
+	}
+	// The start bit is always 1, followed by mode 0.
+	header, ok := manchester(lv[:8], true)
+	if !ok || header != 0x8 {
+		return Decoded{}, false
+	}
+	var toggle bool
+	switch {
+	case lv[8] && lv[9] && !lv[10] && !lv[11]:
+		toggle = true
+	case !lv[8] && !lv[9] && lv[10] && lv[11]:
+	default:
+		return Decoded{}, false
+	}
+	v, ok := manchester(lv[12:], true)
+	if !ok {
+		return Decoded{}, false
+	}
+	return Decoded{
+		Protocol: RC6,
+		Address:  v >> 8,
+		Command:  v & 0xff,
+		Toggle:   toggle,
+		Bits:     16,
+	}, true
+}
+
+// summarize describes the timings of an unrecognized code.
+func summarize(pulses []int, frames int) string {
+	if len(pulses) == 0 {
+		return "no timings"
+	}
+	minPulse, maxPulse, minSpace, maxSpace := math.MaxInt32, 0, math.MaxInt32, 0
+	for i, d := range pulses {
+		if i%2 == 0 {
+			if d < minPulse {
+				minPulse = d
+			}
+			if d > maxPulse {
+				maxPulse = d
+			}
+			continue
+		}
+		if d < minSpace {
+			minSpace = d
+		}
+		if d > maxSpace {
+			maxSpace = d
+		}
+	}
+	s := fmt.Sprintf("%d timings in %d frames, pulses %d-%dµs", len(pulses), frames, minPulse, maxPulse)
+	if maxSpace > 0 {
+		s += fmt.Sprintf(", spaces %d-%dµs", minSpace, maxSpace)
+	}
+	return s
+}
@@ -1,51 +1,142 @@
 package broadlinkrm
 
+// deviceFamily groups device types that share a command set and payload
+// framing.
+type deviceFamily int
+
+// Enumerations of deviceFamily.
+const (
+	familyUnknown deviceFamily = iota
+	familyRM                   // RM2 and RM3
+	familyRM4                  // RM4 - payloads carry a 2-byte length prefix
+	familySP                   // SP1, SP2, SP3 and SP Mini
+	familyMP1                  // MP1 power strip
+	familyA1                   // A1 environmental sensor
+	familyHysen                // Hysen heating controller
+	familyDooya                // Dooya curtain motor
+	familyS1                   // S1 alarm hub
+	familyLB1                  // LB1 and LB2 smart bulbs - JSON payloads
+
+	// familyHysenOrDooya is shared by Hysen and Dooya devices. Such a device
+	// can only be used after its variant is set.
+	familyHysenOrDooya
+)
+
 type deviceCharacteristics struct {
-	known     bool
-	name      string
-	supported bool
-	ir        bool
-	rf        bool
-	power     bool
+	known      bool
+	name       string
+	supported  bool
+	family     deviceFamily
+	ir         bool
+	rf         bool
+	power      bool
+	nightlight bool
+	energy     bool
+	outlets    int
+	sensors    bool
+}
+
+// Capabilities lists what a device type is able to do.
+type Capabilities struct {
+	IR         bool
+	RF         bool
+	Power      bool
+	Nightlight bool
+	Energy     bool
+
+	// Outlets is the number of individually switchable outlets of a power
+	// strip. It is 0 for devices with a single outlet.
+	Outlets int
+
+	// Sensors is true for environmental sensors such as the A1.
+	Sensors bool
+}
+
+func (c deviceCharacteristics) capabilities() Capabilities {
+	return Capabilities{
+		IR:         c.ir,
+		RF:         c.rf,
+		Power:      c.power,
+		Nightlight: c.nightlight,
+		Energy:     c.energy,
+		Outlets:    c.outlets,
+		Sensors:    c.sensors,
+	}
 }
 
 type knownDevice struct {
 	deviceType int
 	name       string
 	supported  bool
+	family     deviceFamily
 	ir         bool
 	rf         bool
 	power      bool
+	nightlight bool
+	energy     bool
+	outlets    int
+	sensors    bool
 }
 
 var knownDevices = []knownDevice{
-	{deviceType: 0x2737, name: "Broadlink RM Mini", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x273d, name: "Broadlink RM Pro Phicom", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x2712, name: "Broadlink RM2", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x2783, name: "Broadlink RM2 Home Plus", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x277c, name: "Broadlink RM2 Home Plus GDT", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x278f, name: "Broadlink RM Mini Shate", supported: true, ir: true, rf: false, power: false},
-	{deviceType: 0x272a, name: "Broadlink RM2 Pro Plus", supported: true, ir: true, rf: true, power: false},
-	{deviceType: 0x2787, name: "Broadlink RM2 Pro Plus v2", supported: true, ir: true, rf: true, power: false},
-	{deviceType: 0x278b, name: "Broadlink RM2 Pro Plus BL", supported: true, ir: true, rf: true, power: false},
-	{deviceType: 0x279d, name: "Broadlink RM3 Pro Plus", supported: true, ir: true, rf: true, power: false},
-	{deviceType: 0x27a9, name: "Broadlink RM3 Pro Plus v2", supported: true, ir: true, rf: true, power: false},
-	{deviceType: 0, name: "Broadlink SP1", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x2711, name: "Broadlink SP2", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x2719, name: "Honeywell SP2", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x7919, name: "Honeywell SP2", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x271a, name: "Honeywell SP2", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x791a, name: "Honeywell SP2", supported: true, ir: false, rf: false, power: true},
-	{deviceType: 0x2733, name: "OEM Branded SP Mini", supported: false},
-	{deviceType: 0x273e, name: "OEM Branded SP Mini", supported: false},
-	{deviceType: 0x2720, name: "Broadlink SP Mini", supported: false},
-	{deviceType: 0x753e, name: "Broadlink SP 3", supported: false},
-	{deviceType: 0x2728, name: "Broadlink SPMini 2", supported: false},
-	{deviceType: 0x2736, name: "Broadlink SPMini Plus", supported: false},
-	{deviceType: 0x2714, name: "Broadlink A1", supported: false},
-	{deviceType: 0x4eb5, name: "Broadlink MP1", supported: false},
-	{deviceType: 0x2722, name: "Broadlink S1 (SmartOne Alarm Kit)", supported: false},
-	{deviceType: 0x4e4d, name: "Dooya DT360E (DOOYA_CURTAIN_V2) or Hysen Heating Controller", supported: false},
+	{deviceType: 0x2737, name: "Broadlink RM Mini", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x273d, name: "Broadlink RM Pro Phicom", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x2712, name: "Broadlink RM2", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x2783, name: "Broadlink RM2 Home Plus", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x277c, name: "Broadlink RM2 Home Plus GDT", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x278f, name: "Broadlink RM Mini Shate", supported: true, family: familyRM, ir: true, rf: false, power: false},
+	{deviceType: 0x272a, name: "Broadlink RM2 Pro Plus", supported: true, family: familyRM, ir: true, rf: true, power: false},
+	{deviceType: 0x2787, name: "Broadlink RM2 Pro Plus v2", supported: true, family: familyRM, ir: true, rf: true, power: false},
+	{deviceType: 0x278b, name: "Broadlink RM2 Pro Plus BL", supported: true, family: familyRM, ir: true, rf: true, power: false},
+	{deviceType: 0x279d, name: "Broadlink RM3 Pro Plus", supported: true, family: familyRM, ir: true, rf: true, power: false},
+	{deviceType: 0x27a9, name: "Broadlink RM3 Pro Plus v2", supported: true, family: familyRM, ir: true, rf: true, power: false},
+	{deviceType: 0x51da, name: "Broadlink RM4 Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x5f36, name: "Broadlink RM Mini 3", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x6070, name: "Broadlink RM4C Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x610e, name: "Broadlink RM4 Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x610f, name: "Broadlink RM4C Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x62bc, name: "Broadlink RM4 Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x62be, name: "Broadlink RM4C Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x6364, name: "Broadlink RM4S", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x648d, name: "Broadlink RM4 Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x6539, name: "Broadlink RM4C Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x653a, name: "Broadlink RM4 Mini", supported: true, family: familyRM4, ir: true, rf: false, power: false},
+	{deviceType: 0x6026, name: "Broadlink RM4 Pro", supported: true, family: familyRM4, ir: true, rf: true, power: false},
+	{deviceType: 0x6184, name: "Broadlink RM4C Pro", supported: true, family: familyRM4, ir: true, rf: true, power: false},
+	{deviceType: 0x61a2, name: "Broadlink RM4 Pro", supported: true, family: familyRM4, ir: true, rf: true, power: false},
+	{deviceType: 0x649b, name: "Broadlink RM4 Pro", supported: true, family: familyRM4, ir: true, rf: true, power: false},
+	{deviceType: 0x653c, name: "Broadlink RM4 Pro", supported: true, family: familyRM4, ir: true, rf: true, power: false},
+	{deviceType: 0, name: "Broadlink SP1", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x2711, name: "Broadlink SP2", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x2719, name: "Honeywell SP2", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x7919, name: "Honeywell SP2", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x271a, name: "Honeywell SP2", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x791a, name: "Honeywell SP2", supported: true, family: familySP, ir: false, rf: false, power: true},
+	{deviceType: 0x2733, name: "OEM Branded SP Mini", supported: true, family: familySP, power: true},
+	{deviceType: 0x273e, name: "OEM Branded SP Mini", supported: true, family: familySP, power: true},
+	{deviceType: 0x2720, name: "Broadlink SP Mini", supported: true, family: familySP, power: true},
+	{deviceType: 0x753e, name: "Broadlink SP 3", supported: true, family: familySP, power: true, nightlight: true},
+	{deviceType: 0x9479, name: "Broadlink SP3S-US", supported: true, family: familySP, power: true, nightlight: true, energy: true},
+	{deviceType: 0x947a, name: "Broadlink SP3S-EU", supported: true, family: familySP, power: true, nightlight: true, energy: true},
+	{deviceType: 0x2728, name: "Broadlink SPMini 2", supported: true, family: familySP, power: true},
+	{deviceType: 0x2736, name: "Broadlink SPMini Plus", supported: true, family: familySP, power: true},
+	{deviceType: 0x2714, name: "Broadlink A1", supported: true, family: familyA1, sensors: true},
+	{deviceType: 0x4eb5, name: "Broadlink MP1", supported: true, family: familyMP1, power: true, outlets: 4},
+	{deviceType: 0x4ef7, name: "Honyar MP1", supported: true, family: familyMP1, power: true, outlets: 4},
+	{deviceType: 0x2722, name: "Broadlink S1 (SmartOne Alarm Kit)", supported: true, family: familyS1},
+	{deviceType: 0x4e4d, name: "Dooya DT360E (DOOYA_CURTAIN_V2) or Hysen Heating Controller", supported: true, family: familyHysenOrDooya},
+	{deviceType: 0x4ead, name: "Hysen Heating Controller", supported: true, family: familyHysen},
+	{deviceType: 0x5043, name: "Broadlink SB800TD", supported: true, family: familyLB1},
+	{deviceType: 0x504e, name: "Broadlink LB1", supported: true, family: familyLB1},
+	{deviceType: 0x606e, name: "Broadlink SB500TD", supported: true, family: familyLB1},
+	{deviceType: 0x60c7, name: "Broadlink LB1", supported: true, family: familyLB1},
+	{deviceType: 0x60c8, name: "Broadlink LB1", supported: true, family: familyLB1},
+	{deviceType: 0x6112, name: "Broadlink LB1", supported: true, family: familyLB1},
+	{deviceType: 0x644b, name: "Broadlink LB1", supported: true, family: familyLB1},
+	{deviceType: 0x644c, name: "Broadlink LB27 R1", supported: true, family: familyLB1},
+	{deviceType: 0x644e, name: "Broadlink LB26 R1", supported: true, family: familyLB1},
+	{deviceType: 0xa4f4, name: "Broadlink LB27 R1 (LB2)", supported: true, family: familyLB1},
+	{deviceType: 0xa5f7, name: "Broadlink LB27 R1 (LB2)", supported: true, family: familyLB1},
 }
 
 func isKnownDevice(dt int) deviceCharacteristics {
@@ -55,9 +146,14 @@ func isKnownDevice(dt int) deviceCharacteristics {
 			resp.known = true
 			resp.name = d.name
 			resp.supported = d.supported
+			resp.family = d.family
 			resp.ir = d.ir
 			resp.rf = d.rf
 			resp.power = d.power
+			resp.nightlight = d.nightlight
+			resp.energy = d.energy
+			resp.outlets = d.outlets
+			resp.sensors = d.sensors
 			break
 		}
 	}
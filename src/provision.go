@@ -0,0 +1,110 @@
+package broadlinkrm
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// A device that has not been set up yet runs its own access point, usually
+// named BroadlinkProv. Once a client has joined it, the device accepts a join
+// command (0x14) with the SSID, password and security mode of the network that
+// it should connect to. Based on the setup function in
+// https://github.com/mjg59/python-broadlink
+
+const (
+	provisionSSIDOffset     = 0x44
+	provisionPasswordOffset = 0x64
+	provisionMaxLength      = 32
+)
+
+// SecurityMode is the type of encryption used by a WiFi network.
+type SecurityMode int
+
+// Enumerations of SecurityMode.
+const (
+	SecurityNone SecurityMode = iota
+	SecurityWEP
+	SecurityWPA1
+	SecurityWPA2
+	SecurityWPA1WPA2
+)
+
+func (m SecurityMode) String() string {
+	switch m {
+	case SecurityNone:
+		return "none"
+	case SecurityWEP:
+		return "wep"
+	case SecurityWPA1:
+		return "wpa1"
+	case SecurityWPA2:
+		return "wpa2"
+	case SecurityWPA1WPA2:
+		return "wpa1/2"
+	}
+	return "unknown"
+}
+
+// ParseSecurityMode is the inverse of SecurityMode.String. It also accepts wpa
+// for SecurityWPA1WPA2.
+func ParseSecurityMode(s string) (SecurityMode, error) {
+	if strings.EqualFold(s, "wpa") {
+		return SecurityWPA1WPA2, nil
+	}
+	for m := SecurityNone; m <= SecurityWPA1WPA2; m++ {
+		if strings.EqualFold(s, m.String()) {
+			return m, nil
+		}
+	}
+	return SecurityNone, fmt.Errorf("%v is not a valid security mode - expected none, wep, wpa1, wpa2 or wpa1/2", s)
+}
+
+// Provision tells a device in AP mode to join a WiFi network. The host running
+// this must be connected to the device's access point. If ip is an empty
+// string the command is broadcast to 255.255.255.255. The device does not
+// answer - once it has joined the network it can be found with Discover.
+func (b *Broadlink) Provision(ip, ssid, password string, security SecurityMode) error {
+	packet, err := provisionPacket(ssid, password, security)
+	if err != nil {
+		return err
+	}
+	if len(ip) == 0 {
+		ip = "255.255.255.255"
+	}
+
+	conn, err := b.transport.ListenPacket()
+	if err != nil {
+		return fmt.Errorf("could not setup UDP listener: %v", err)
+	}
+	defer conn.Close()
+
+	if err := sendPacket(packet, conn, deviceAddress(b.transport, ip)); err != nil {
+		return err
+	}
+	log.Printf("Sent WiFi settings for network %v to %v", ssid, ip)
+	return nil
+}
+
+func provisionPacket(ssid, password string, security SecurityMode) ([]byte, error) {
+	if len(ssid) == 0 || len(ssid) > provisionMaxLength {
+		return nil, fmt.Errorf("SSID has a length of %v bytes - it should have a length of 1 to %v bytes", len(ssid), provisionMaxLength)
+	}
+	if len(password) > provisionMaxLength {
+		return nil, fmt.Errorf("password has a length of %v bytes - it should not be longer than %v bytes", len(password), provisionMaxLength)
+	}
+	if security < SecurityNone || security > SecurityWPA1WPA2 {
+		return nil, fmt.Errorf("%d is not a valid security mode", security)
+	}
+
+	packet := make([]byte, 0x88, 0x88)
+	packet[0x26] = 0x14
+	copy(packet[provisionSSIDOffset:], ssid)
+	copy(packet[provisionPasswordOffset:], password)
+	packet[0x84] = byte(len(ssid))
+	packet[0x85] = byte(len(password))
+	packet[0x86] = byte(security)
+	checksum := calculateChecksum(packet)
+	copy(packet[0x20:], checksum[:])
+	return packet, nil
+}
@@ -0,0 +1,29 @@
+package rmweb
+
+import (
+	"fmt"
+
+	"github.com/kwkoo/broadlinkrm"
+)
+
+type bulbStateJSON struct {
+	Power      bool   `json:"power"`
+	Brightness int    `json:"brightness"`
+	ColorMode  string `json:"colormode"`
+	ColorTemp  int    `json:"colortemp"`
+	Color      string `json:"color"`
+	Hue        int    `json:"hue"`
+	Saturation int    `json:"saturation"`
+}
+
+func newBulbStateJSON(s broadlinkrm.BulbState) bulbStateJSON {
+	return bulbStateJSON{
+		Power:      s.Power,
+		Brightness: s.Brightness,
+		ColorMode:  s.ColorMode.String(),
+		ColorTemp:  s.ColorTemp,
+		Color:      fmt.Sprintf("%02x%02x%02x", s.Red, s.Green, s.Blue),
+		Hue:        s.Hue,
+		Saturation: s.Saturation,
+	}
+}
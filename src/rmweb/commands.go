@@ -1,17 +1,70 @@
 package rmweb
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/kwkoo/broadlinkrm/ircode"
 )
 
-// Command represents a remote command code.
+// Command represents a remote command code. In the JSON, data is either the
+// code as a hex string or an object that describes an IR code by its protocol,
+// e.g. {"protocol":"nec","address":4,"command":8}. IngestCommands converts such
+// objects to hex strings.
 type Command struct {
 	Group   string `json:"group"`
 	Command string `json:"command"`
 	Data    string `json:"data"`
+
+	code *codeParams
+}
+
+// codeParams describes an IR code that is generated instead of learned. Bits
+// only applies to Sony codes, extended to 20-bit Sony codes and toggle to RC5
+// and RC6 codes.
+type codeParams struct {
+	Protocol string `json:"protocol"`
+	Address  int    `json:"address"`
+	Command  int    `json:"command"`
+	Extended int    `json:"extended"`
+	Bits     int    `json:"bits"`
+	Toggle   bool   `json:"toggle"`
+	Repeats  int    `json:"repeats"`
+}
+
+// UnmarshalJSON accepts data as either a string or a codeParams object.
+func (c *Command) UnmarshalJSON(b []byte) error {
+	raw := struct {
+		Group   string          `json:"group"`
+		Command string          `json:"command"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+	if err := unmarshalStrict(b, &raw); err != nil {
+		return err
+	}
+	c.Group = raw.Group
+	c.Command = raw.Command
+	c.Data = ""
+	c.code = nil
+
+	data := bytes.TrimSpace(raw.Data)
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] != '{' {
+		return json.Unmarshal(data, &c.Data)
+	}
+	c.code = &codeParams{}
+	return unmarshalStrict(data, c.code)
+}
+
+func unmarshalStrict(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
 }
 
 // IngestCommands reads a JSON stream and returns a slice of Command structs.
@@ -25,11 +78,50 @@ func IngestCommands(r io.Reader) ([]Command, error) {
 		return c, fmt.Errorf("error decoding commands JSON: %v", err)
 	}
 
-	for _, cmd := range c {
+	for i, cmd := range c {
 		if strings.Contains(cmd.Command, " ") {
 			return c, fmt.Errorf("command \"%v\" should not contain a space", cmd.Command)
 		}
+		if cmd.code == nil {
+			continue
+		}
+		data, err := cmd.code.generate()
+		if err != nil {
+			return c, fmt.Errorf("error generating code for command \"%v\" in group \"%v\": %v", cmd.Command, cmd.Group, err)
+		}
+		c[i].Data = data
 	}
 
 	return c, nil
 }
+
+// generate builds the code as a hex string.
+func (p codeParams) generate() (string, error) {
+	protocol, err := ircode.ParseProtocol(p.Protocol)
+	if err != nil {
+		return "", err
+	}
+	code, err := ircode.Generate(ircode.Decoded{
+		Protocol: protocol,
+		Address:  p.Address,
+		Command:  p.Command,
+		Extended: p.Extended,
+		Bits:     p.Bits,
+		Toggle:   p.Toggle,
+		Repeats:  p.Repeats,
+	})
+	if err != nil {
+		return "", err
+	}
+	return ircode.EncodeString(code)
+}
+
+// identifyCode describes the IR protocol of a learned code, or why it could
+// not be decoded.
+func identifyCode(data string) string {
+	c, err := ircode.DecodeString(data)
+	if err != nil {
+		return fmt.Sprintf("could not decode code: %v", err)
+	}
+	return ircode.Identify(c).String()
+}
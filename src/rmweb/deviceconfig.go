@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/kwkoo/broadlinkrm"
 )
 
 // DeviceConfig represents a manually configured device (versus a device that
@@ -14,6 +17,10 @@ type DeviceConfig struct {
 	Key        string `json:"key"`
 	ID         string `json:"id"`
 	DeviceType int    `json:"type"`
+
+	// Variant distinguishes products that share a device type, e.g. hysen
+	// or dooya for device type 0x4e4d.
+	Variant string `json:"variant,omitempty"`
 }
 
 // IngestDeviceConfig reads a JSON stream and returns a slice of DeviceConfig
@@ -30,3 +37,69 @@ func IngestDeviceConfig(r io.Reader) ([]DeviceConfig, error) {
 
 	return d, nil
 }
+
+// NewDeviceConfig converts the credentials of devices to device
+// configurations, e.g. so that discovered devices can be added manually the
+// next time.
+func NewDeviceConfig(creds []broadlinkrm.Credentials) []DeviceConfig {
+	d := make([]DeviceConfig, 0, len(creds))
+	for _, c := range creds {
+		d = append(d, DeviceConfig{
+			IP:         c.IP,
+			Mac:        c.MAC,
+			Key:        c.Key,
+			ID:         c.ID,
+			DeviceType: c.DeviceType,
+			Variant:    c.Variant,
+		})
+	}
+	return d
+}
+
+// MergeDeviceConfig updates existing with the devices in current. Devices are
+// matched by MAC address, or by IP address if either has no MAC address.
+// Devices that are only in existing are kept, and devices that are only in
+// current are appended. The variant of an existing device is kept unless
+// current sets one.
+func MergeDeviceConfig(existing, current []DeviceConfig) []DeviceConfig {
+	merged := make([]DeviceConfig, len(existing))
+	copy(merged, existing)
+	for _, c := range current {
+		i := findDeviceConfig(merged, c)
+		if i < 0 {
+			merged = append(merged, c)
+			continue
+		}
+		if len(c.Variant) == 0 {
+			c.Variant = merged[i].Variant
+		}
+		merged[i] = c
+	}
+	return merged
+}
+
+func findDeviceConfig(configs []DeviceConfig, c DeviceConfig) int {
+	for i, e := range configs {
+		if len(e.Mac) > 0 && len(c.Mac) > 0 {
+			if strings.EqualFold(e.Mac, c.Mac) {
+				return i
+			}
+			continue
+		}
+		if e.IP == c.IP {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteDeviceConfig writes device configurations as JSON in the format read
+// by IngestDeviceConfig.
+func WriteDeviceConfig(w io.Writer, configs []DeviceConfig) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(configs); err != nil {
+		return fmt.Errorf("error encoding device config JSON: %v", err)
+	}
+	return nil
+}
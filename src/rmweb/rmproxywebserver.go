@@ -1,9 +1,12 @@
 package rmweb
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/kwkoo/broadlinkrm"
@@ -11,7 +14,7 @@ import (
 
 // RMProxyWebServer is a consolidation of all web server logic.
 type RMProxyWebServer struct {
-	broadlink   broadlinkrm.Broadlink
+	broadlink   *broadlinkrm.Broadlink
 	key         string
 	rooms       Rooms
 	macros      map[string]RemoteCommandMessage
@@ -20,7 +23,7 @@ type RMProxyWebServer struct {
 }
 
 // NewRMProxyWebServer instantiates a new RMProxyWebServer struct.
-func NewRMProxyWebServer(broadlink broadlinkrm.Broadlink, key string, rooms Rooms, macros map[string]RemoteCommandMessage, haconfig *HomeAssistantConfig, ch chan RemoteCommandMessage) RMProxyWebServer {
+func NewRMProxyWebServer(broadlink *broadlinkrm.Broadlink, key string, rooms Rooms, macros map[string]RemoteCommandMessage, haconfig *HomeAssistantConfig, ch chan RemoteCommandMessage) RMProxyWebServer {
 	return RMProxyWebServer{
 		broadlink:   broadlink,
 		key:         key,
@@ -102,6 +105,10 @@ func (proxy RMProxyWebServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if len(components) == 2 {
+			proxy.handleQueryOutlet(w, r, components[0], components[1])
+			return
+		}
 		if len(components) != 1 {
 			http.Error(w, "Invalid command", http.StatusNotFound)
 			return
@@ -109,6 +116,182 @@ func (proxy RMProxyWebServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		proxy.handleQuery(w, r, components[0])
 		return
 	}
+	if strings.HasPrefix(path, "/nightlight/") {
+		components, authorized := proxy.processURI("/nightlight/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) == 1 {
+			proxy.handleNightlight(w, r, components[0], "")
+			return
+		}
+		if len(components) != 2 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleNightlight(w, r, components[0], components[1])
+		return
+	}
+	if strings.HasPrefix(path, "/energy/") {
+		components, authorized := proxy.processURI("/energy/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) != 1 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleEnergy(w, r, components[0])
+		return
+	}
+	if strings.HasPrefix(path, "/thermostat/") {
+		components, authorized := proxy.processURI("/thermostat/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) == 1 {
+			proxy.handleThermostatStatus(w, r, components[0])
+			return
+		}
+		if len(components) != 3 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleThermostat(w, r, components[0], components[1], components[2])
+		return
+	}
+	if strings.HasPrefix(path, "/info/") {
+		components, authorized := proxy.processURI("/info/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) == 1 {
+			proxy.handleDeviceInfo(w, r, components[0])
+			return
+		}
+		if len(components) != 3 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleSetDeviceInfo(w, r, components[0], components[1], components[2])
+		return
+	}
+	if strings.HasPrefix(path, "/bulb/") {
+		components, authorized := proxy.processURI("/bulb/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) == 1 {
+			proxy.handleBulbState(w, r, components[0])
+			return
+		}
+		if len(components) != 3 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleBulb(w, r, components[0], components[1], components[2])
+		return
+	}
+	if strings.HasPrefix(path, "/curtain/") {
+		components, authorized := proxy.processURI("/curtain/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) == 1 {
+			proxy.handleCurtain(w, r, components[0], "")
+			return
+		}
+		if len(components) != 2 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleCurtain(w, r, components[0], components[1])
+		return
+	}
+	if strings.HasPrefix(path, "/alarm/") {
+		components, authorized := proxy.processURI("/alarm/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) != 1 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleAlarm(w, r, components[0])
+		return
+	}
+	if strings.HasPrefix(path, "/sensors/") {
+		components, authorized := proxy.processURI("/sensors/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) != 1 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleSensors(w, r, components[0])
+		return
+	}
+	if strings.HasPrefix(path, "/temperature/") {
+		components, authorized := proxy.processURI("/temperature/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) != 1 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleTemperature(w, r, components[0])
+		return
+	}
+	if strings.HasPrefix(path, "/humidity/") {
+		components, authorized := proxy.processURI("/humidity/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) != 1 {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleHumidity(w, r, components[0])
+		return
+	}
+	if strings.HasPrefix(path, "/status/") {
+		components, authorized := proxy.processURI("/status/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) > 1 || (len(components) == 1 && len(components[0]) > 0) {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleStatus(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/deviceconfig/") {
+		components, authorized := proxy.processURI("/deviceconfig/", path)
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(components) > 1 || (len(components) == 1 && len(components[0]) > 0) {
+			http.Error(w, "Invalid command", http.StatusNotFound)
+			return
+		}
+		proxy.handleDeviceConfig(w, r)
+		return
+	}
 	if strings.HasPrefix(path, "/homeassistant/") {
 		components, authorized := proxy.processURI("/homeassistant/", path)
 		if !authorized {
@@ -129,26 +312,32 @@ func (proxy RMProxyWebServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 func (proxy *RMProxyWebServer) handleLearn(w http.ResponseWriter, r *http.Request, host string) {
 	w.Header().Set("Content-type", "text/plain")
 	log.Printf("Learn %v", host)
-	data, err := proxy.broadlink.Learn(host)
+	data, err := proxy.broadlink.LearnContext(r.Context(), host)
 	if err != nil {
 		fmt.Fprintf(w, "Error: %v\n", err)
 		log.Printf("Error: %v", err)
 		return
 	}
+	protocol := identifyCode(data)
+	log.Printf("Learned code: %v", protocol)
 	fmt.Fprintln(w, data)
+	fmt.Fprintln(w, protocol)
 	return
 }
 
 func (proxy *RMProxyWebServer) handleLearnRF(w http.ResponseWriter, r *http.Request, host string) {
 	w.Header().Set("Content-type", "text/plain")
 	log.Printf("Learn RF %v", host)
-	data, err := proxy.broadlink.LearnRF(host)
+	data, err := proxy.broadlink.LearnRFContext(r.Context(), host)
 	if err != nil {
 		fmt.Fprintf(w, "Error: %v\n", err)
 		log.Printf("Error: %v", err)
 		return
 	}
+	protocol := identifyCode(data)
+	log.Printf("Learned code: %v", protocol)
 	fmt.Fprintln(w, data)
+	fmt.Fprintln(w, protocol)
 	return
 }
 
@@ -187,7 +376,7 @@ func (proxy *RMProxyWebServer) handleMacro(w http.ResponseWriter, r *http.Reques
 func (proxy *RMProxyWebServer) handleQuery(w http.ResponseWriter, r *http.Request, host string) {
 	w.Header().Set("Content-type", "text/plain")
 	log.Printf("Query %v", host)
-	state, err := proxy.broadlink.GetPowerState(host)
+	state, err := proxy.broadlink.GetPowerStateContext(r.Context(), host)
 	if err != nil {
 		fmt.Fprintf(w, "Error: %v\n", err)
 		log.Printf("Error: %v", err)
@@ -197,6 +386,378 @@ func (proxy *RMProxyWebServer) handleQuery(w http.ResponseWriter, r *http.Reques
 	return
 }
 
+// handleQueryOutlet returns whether an outlet of a power strip is switched on.
+// Outlets are numbered from 1.
+func (proxy *RMProxyWebServer) handleQueryOutlet(w http.ResponseWriter, r *http.Request, host, outlet string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Query outlet %v of %v", outlet, host)
+	n, err := strconv.Atoi(outlet)
+	if err != nil {
+		errmsg := fmt.Sprintf("Error: outlet %v is not a valid number", outlet)
+		fmt.Fprintln(w, errmsg)
+		log.Print(errmsg)
+		return
+	}
+	state, err := proxy.broadlink.GetOutletPowerContext(r.Context(), host, n)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, state)
+	return
+}
+
+// handleNightlight returns the state of the nightlight if state is empty, and
+// sets it otherwise.
+func (proxy *RMProxyWebServer) handleNightlight(w http.ResponseWriter, r *http.Request, host, state string) {
+	w.Header().Set("Content-type", "text/plain")
+	if len(state) == 0 {
+		log.Printf("Query nightlight %v", host)
+		on, err := proxy.broadlink.GetNightlightContext(r.Context(), host)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			log.Printf("Error: %v", err)
+			return
+		}
+		fmt.Fprintln(w, on)
+		return
+	}
+
+	log.Printf("Set nightlight %v to %v", host, state)
+	var on bool
+	switch state {
+	case "0", "00":
+		on = false
+	case "1", "01":
+		on = true
+	default:
+		errmsg := fmt.Sprintf("Error: nightlight state must be 0 or 1 - got %v instead", state)
+		fmt.Fprintln(w, errmsg)
+		log.Print(errmsg)
+		return
+	}
+	if err := proxy.broadlink.SetNightlightContext(r.Context(), host, on); err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+	return
+}
+
+func (proxy *RMProxyWebServer) handleEnergy(w http.ResponseWriter, r *http.Request, host string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Energy %v", host)
+	watts, err := proxy.broadlink.GetEnergyContext(r.Context(), host)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, strconv.FormatFloat(watts, 'f', -1, 64))
+	return
+}
+
+func (proxy *RMProxyWebServer) handleThermostatStatus(w http.ResponseWriter, r *http.Request, host string) {
+	log.Printf("Thermostat status %v", host)
+	status, err := proxy.broadlink.GetThermostatStatusContext(r.Context(), host)
+	if err != nil {
+		w.Header().Set("Content-type", "text/plain")
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newThermostatStatusJSON(status)); err != nil {
+		log.Printf("Error encoding thermostat status: %v", err)
+	}
+}
+
+// handleThermostat changes a setting of a thermostat. The settings that are
+// not changed are read from the thermostat first so that they are preserved.
+func (proxy *RMProxyWebServer) handleThermostat(w http.ResponseWriter, r *http.Request, host, setting, value string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Set thermostat %v %v to %v", host, setting, value)
+	ctx := r.Context()
+
+	var err error
+	switch setting {
+	case "temperature":
+		var t float64
+		t, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("%v is not a valid temperature", value)
+			break
+		}
+		err = proxy.broadlink.SetThermostatTemperatureContext(ctx, host, t)
+	case "power":
+		if value != "0" && value != "1" {
+			err = fmt.Errorf("power must be 0 or 1 - got %v instead", value)
+			break
+		}
+		err = proxy.broadlink.UpdateThermostatContext(ctx, host, func(status *broadlinkrm.ThermostatStatus) {
+			status.Power = value == "1"
+		})
+	case "mode":
+		if value != "auto" && value != "manual" {
+			err = fmt.Errorf("mode must be auto or manual - got %v instead", value)
+			break
+		}
+		err = proxy.broadlink.UpdateThermostatContext(ctx, host, func(status *broadlinkrm.ThermostatStatus) {
+			status.AutoMode = value == "auto"
+		})
+	default:
+		err = fmt.Errorf("%v is not a valid thermostat setting", setting)
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+	return
+}
+
+func (proxy *RMProxyWebServer) handleDeviceInfo(w http.ResponseWriter, r *http.Request, host string) {
+	log.Printf("Device info %v", host)
+	info, err := proxy.broadlink.GetDeviceInfoContext(r.Context(), host)
+	if err != nil {
+		w.Header().Set("Content-type", "text/plain")
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newDeviceInfoJSON(info)); err != nil {
+		log.Printf("Error encoding device info: %v", err)
+	}
+}
+
+// handleSetDeviceInfo renames a device or sets its lock flag.
+func (proxy *RMProxyWebServer) handleSetDeviceInfo(w http.ResponseWriter, r *http.Request, host, setting, value string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Set device %v %v to %v", host, setting, value)
+	ctx := r.Context()
+
+	var err error
+	switch setting {
+	case "name":
+		err = proxy.broadlink.SetDeviceNameContext(ctx, host, value)
+	case "lock":
+		if value != "0" && value != "1" {
+			err = fmt.Errorf("lock must be 0 or 1 - got %v instead", value)
+			break
+		}
+		err = proxy.broadlink.SetDeviceLockContext(ctx, host, value == "1")
+	default:
+		err = fmt.Errorf("%v is not a valid device setting", setting)
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+	return
+}
+
+func (proxy *RMProxyWebServer) handleBulbState(w http.ResponseWriter, r *http.Request, host string) {
+	log.Printf("Bulb state %v", host)
+	state, err := proxy.broadlink.GetBulbStateContext(r.Context(), host)
+	if err != nil {
+		w.Header().Set("Content-type", "text/plain")
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newBulbStateJSON(state)); err != nil {
+		log.Printf("Error encoding bulb state: %v", err)
+	}
+}
+
+// handleBulb changes a setting of a smart bulb. The colour is given as 6 hex
+// digits, e.g. ff8000.
+func (proxy *RMProxyWebServer) handleBulb(w http.ResponseWriter, r *http.Request, host, setting, value string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Set bulb %v %v to %v", host, setting, value)
+	ctx := r.Context()
+
+	var err error
+	switch setting {
+	case "power":
+		if value != "0" && value != "1" {
+			err = fmt.Errorf("power must be 0 or 1 - got %v instead", value)
+			break
+		}
+		err = proxy.broadlink.SetBulbPowerContext(ctx, host, value == "1")
+	case "brightness":
+		var brightness int
+		brightness, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("%v is not a valid brightness", value)
+			break
+		}
+		err = proxy.broadlink.SetBulbBrightnessContext(ctx, host, brightness)
+	case "color":
+		var rgb []byte
+		rgb, err = hex.DecodeString(value)
+		if err != nil || len(rgb) != 3 {
+			err = fmt.Errorf("%v is not a valid colour - expected 6 hex digits", value)
+			break
+		}
+		err = proxy.broadlink.SetBulbColorContext(ctx, host, int(rgb[0]), int(rgb[1]), int(rgb[2]))
+	default:
+		err = fmt.Errorf("%v is not a valid bulb setting", setting)
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+	return
+}
+
+// handleCurtain returns the position of the curtain if action is empty.
+// Otherwise the action is open, close, stop, or a position in percent.
+func (proxy *RMProxyWebServer) handleCurtain(w http.ResponseWriter, r *http.Request, host, action string) {
+	w.Header().Set("Content-type", "text/plain")
+	ctx := r.Context()
+
+	if len(action) == 0 {
+		log.Printf("Query curtain %v", host)
+		position, err := proxy.broadlink.GetCurtainPositionContext(ctx, host)
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			log.Printf("Error: %v", err)
+			return
+		}
+		fmt.Fprintln(w, position)
+		return
+	}
+
+	log.Printf("Curtain %v %v", host, action)
+	var err error
+	switch action {
+	case "open":
+		err = proxy.broadlink.OpenCurtainContext(ctx, host)
+	case "close":
+		err = proxy.broadlink.CloseCurtainContext(ctx, host)
+	case "stop":
+		err = proxy.broadlink.StopCurtainContext(ctx, host)
+	default:
+		var position int
+		position, err = strconv.Atoi(action)
+		if err != nil {
+			err = fmt.Errorf("%v is not a valid curtain action", action)
+			break
+		}
+		err = proxy.broadlink.SetCurtainPositionContext(ctx, host, position)
+	}
+
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+	return
+}
+
+func (proxy *RMProxyWebServer) handleSensors(w http.ResponseWriter, r *http.Request, host string) {
+	log.Printf("Sensors %v", host)
+	readings, err := proxy.broadlink.GetSensorsContext(r.Context(), host)
+	if err != nil {
+		w.Header().Set("Content-type", "text/plain")
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newSensorReadingsJSON(readings)); err != nil {
+		log.Printf("Error encoding sensor readings: %v", err)
+	}
+}
+
+func (proxy *RMProxyWebServer) handleAlarm(w http.ResponseWriter, r *http.Request, host string) {
+	log.Printf("Alarm sensors %v", host)
+	sensors, err := proxy.broadlink.GetAlarmSensorsContext(r.Context(), host)
+	if err != nil {
+		w.Header().Set("Content-type", "text/plain")
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newAlarmSensorsJSON(sensors)); err != nil {
+		log.Printf("Error encoding alarm sensors: %v", err)
+	}
+}
+
+func (proxy *RMProxyWebServer) handleTemperature(w http.ResponseWriter, r *http.Request, host string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Temperature %v", host)
+	temperature, err := proxy.broadlink.GetTemperatureContext(r.Context(), host)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, strconv.FormatFloat(temperature, 'f', -1, 64))
+	return
+}
+
+func (proxy *RMProxyWebServer) handleHumidity(w http.ResponseWriter, r *http.Request, host string) {
+	w.Header().Set("Content-type", "text/plain")
+	log.Printf("Humidity %v", host)
+	humidity, err := proxy.broadlink.GetHumidityContext(r.Context(), host)
+	if err != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		log.Printf("Error: %v", err)
+		return
+	}
+	fmt.Fprintln(w, strconv.FormatFloat(humidity, 'f', -1, 64))
+	return
+}
+
+func (proxy *RMProxyWebServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	log.Print("Status")
+	statuses := proxy.broadlink.Status()
+	resp := make([]deviceStatusJSON, 0, len(statuses))
+	for _, s := range statuses {
+		resp = append(resp, newDeviceStatusJSON(s))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp); err != nil {
+		log.Printf("Error encoding status: %v", err)
+	}
+}
+
+func (proxy *RMProxyWebServer) handleDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	log.Print("Device config")
+	if err := WriteDeviceConfig(w, NewDeviceConfig(proxy.broadlink.Credentials())); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
 func (proxy *RMProxyWebServer) handleHomeAssistant(w http.ResponseWriter, r *http.Request, command string) {
 	w.Header().Set("Content-type", "text/plain")
 	log.Printf("Execute Home Assistant command %v", command)
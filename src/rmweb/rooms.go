@@ -13,10 +13,12 @@ type Rooms struct {
 	groups map[string]map[string]Command
 }
 
-// Room maps groups to devices.
+// Room maps groups to devices. If Outlet is set, the host is a power strip
+// and commands are sent to that outlet.
 type Room struct {
 	Name   string   `json:"name"`
 	Host   string   `json:"host"`
+	Outlet int      `json:"outlet,omitempty"`
 	Groups []string `json:"groups"`
 }
 
@@ -68,6 +70,9 @@ func (r Rooms) RemoteCode(roomName, commandName string) (string, string, error)
 		if !ok {
 			continue
 		}
+		if rm.Outlet > 0 {
+			return rm.Host, fmt.Sprintf("%d:%v", rm.Outlet, command.Data), nil
+		}
 		return rm.Host, command.Data, nil
 	}
 	return "", "", fmt.Errorf("command %v not found in room %v", commandName, roomName)
@@ -52,7 +52,7 @@ func (msg *RemoteCommandMessage) appendMessage(cmdtype cmdType, target, data str
 // SendWorker pulls RemoteCommandMessages off the channel and sends them to the
 // IR blasters. Its purpose is to avoid multiple entities sending commands
 // to the same IR blaster at the same time.
-func SendWorker(ch chan RemoteCommandMessage, broadlink broadlinkrm.Broadlink, wg *sync.WaitGroup) {
+func SendWorker(ch chan RemoteCommandMessage, broadlink *broadlinkrm.Broadlink, wg *sync.WaitGroup) {
 	for msg := range ch {
 		for _, cmd := range msg.commands {
 			switch cmd.commandType {
@@ -0,0 +1,45 @@
+package rmweb
+
+import (
+	"github.com/kwkoo/broadlinkrm"
+)
+
+type sensorReadingsJSON struct {
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+	Light       string  `json:"light"`
+	AirQuality  string  `json:"airquality"`
+	Noise       string  `json:"noise"`
+}
+
+func newSensorReadingsJSON(r broadlinkrm.SensorReadings) sensorReadingsJSON {
+	return sensorReadingsJSON{
+		Temperature: r.Temperature,
+		Humidity:    r.Humidity,
+		Light:       r.Light.String(),
+		AirQuality:  r.AirQuality.String(),
+		Noise:       r.Noise.String(),
+	}
+}
+
+type alarmSensorJSON struct {
+	Name   string `json:"name"`
+	Serial string `json:"serial"`
+	Type   string `json:"type"`
+	State  string `json:"state"`
+	Status int    `json:"status"`
+}
+
+func newAlarmSensorsJSON(sensors []broadlinkrm.AlarmSensor) []alarmSensorJSON {
+	resp := make([]alarmSensorJSON, 0, len(sensors))
+	for _, s := range sensors {
+		resp = append(resp, alarmSensorJSON{
+			Name:   s.Name,
+			Serial: s.Serial,
+			Type:   s.Type.String(),
+			State:  s.State.String(),
+			Status: s.Status,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,52 @@
+package rmweb
+
+import (
+	"time"
+
+	"github.com/kwkoo/broadlinkrm"
+)
+
+type deviceStatusJSON struct {
+	IP                  string  `json:"ip"`
+	Mac                 string  `json:"mac"`
+	DeviceType          int     `json:"type"`
+	Model               string  `json:"model"`
+	Name                string  `json:"name,omitempty"`
+	Online              bool    `json:"online"`
+	LastSeen            string  `json:"lastseen,omitempty"`
+	ConsecutiveFailures int     `json:"failures"`
+	Latency             float64 `json:"latencyms"`
+}
+
+func newDeviceStatusJSON(s broadlinkrm.DeviceStatus) deviceStatusJSON {
+	resp := deviceStatusJSON{
+		IP:                  s.IP,
+		Mac:                 s.MAC,
+		DeviceType:          s.DeviceType,
+		Model:               s.Model,
+		Name:                s.Name,
+		Online:              s.Online,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		Latency:             float64(s.Latency) / float64(time.Millisecond),
+	}
+	if !s.LastSeen.IsZero() {
+		resp.LastSeen = s.LastSeen.Format(time.RFC3339)
+	}
+	return resp
+}
+
+type deviceInfoJSON struct {
+	Name     string `json:"name"`
+	Locked   bool   `json:"locked"`
+	Cloud    bool   `json:"cloud"`
+	Firmware int    `json:"firmware"`
+}
+
+func newDeviceInfoJSON(i broadlinkrm.DeviceInfo) deviceInfoJSON {
+	return deviceInfoJSON{
+		Name:     i.Name,
+		Locked:   i.Locked,
+		Cloud:    i.Cloud,
+		Firmware: i.Firmware,
+	}
+}
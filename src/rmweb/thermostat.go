@@ -0,0 +1,55 @@
+package rmweb
+
+import (
+	"fmt"
+
+	"github.com/kwkoo/broadlinkrm"
+)
+
+type schedulePeriodJSON struct {
+	Start       string  `json:"start"`
+	Temperature float64 `json:"temperature"`
+}
+
+type thermostatStatusJSON struct {
+	Power               bool                 `json:"power"`
+	RemoteLock          bool                 `json:"remotelock"`
+	Heating             bool                 `json:"heating"`
+	ManualOverride      bool                 `json:"manualoverride"`
+	RoomTemperature     float64              `json:"roomtemperature"`
+	TargetTemperature   float64              `json:"targettemperature"`
+	ExternalTemperature float64              `json:"externaltemperature"`
+	AutoMode            bool                 `json:"automode"`
+	LoopMode            int                  `json:"loopmode"`
+	Sensor              int                  `json:"sensor"`
+	WeekdaySchedule     []schedulePeriodJSON `json:"weekday"`
+	WeekendSchedule     []schedulePeriodJSON `json:"weekend"`
+}
+
+func newThermostatStatusJSON(s broadlinkrm.ThermostatStatus) thermostatStatusJSON {
+	return thermostatStatusJSON{
+		Power:               s.Power,
+		RemoteLock:          s.RemoteLock,
+		Heating:             s.Heating,
+		ManualOverride:      s.ManualOverride,
+		RoomTemperature:     s.RoomTemperature,
+		TargetTemperature:   s.TargetTemperature,
+		ExternalTemperature: s.ExternalTemperature,
+		AutoMode:            s.AutoMode,
+		LoopMode:            s.LoopMode,
+		Sensor:              s.Sensor,
+		WeekdaySchedule:     newScheduleJSON(s.WeekdaySchedule),
+		WeekendSchedule:     newScheduleJSON(s.WeekendSchedule),
+	}
+}
+
+func newScheduleJSON(periods []broadlinkrm.SchedulePeriod) []schedulePeriodJSON {
+	resp := make([]schedulePeriodJSON, 0, len(periods))
+	for _, p := range periods {
+		resp = append(resp, schedulePeriodJSON{
+			Start:       fmt.Sprintf("%02d:%02d", p.StartHour, p.StartMinute),
+			Temperature: p.Temperature,
+		})
+	}
+	return resp
+}
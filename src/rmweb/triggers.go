@@ -0,0 +1,102 @@
+package rmweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/kwkoo/broadlinkrm"
+)
+
+// Trigger runs a macro when a sensor paired with an S1 alarm hub changes to a
+// given state. An example of a triggers JSON would be:
+//
+//	[
+//	  {"sensor":"Front Door", "state":"open", "macro":"hallway_lights_on"},
+//	  {"sensor":"00000002", "state":"motion", "macro":"hallway_lights_on"}
+//	]
+//
+// sensor is matched against the name or the serial number of the sensor.
+// state is one of closed, open, no motion, motion, tampered, disarmed,
+// armed away, armed home or sos.
+type Trigger struct {
+	Sensor string `json:"sensor"`
+	State  string `json:"state"`
+	Macro  string `json:"macro"`
+}
+
+// Triggers holds the triggers that have been matched up with their macros.
+type Triggers struct {
+	triggers []compiledTrigger
+}
+
+type compiledTrigger struct {
+	sensor string
+	state  broadlinkrm.AlarmSensorState
+	macro  string
+	msg    RemoteCommandMessage
+}
+
+// IngestTriggers reads a JSON stream of triggers and checks that their states
+// and macros are valid.
+func IngestTriggers(r io.Reader, macros map[string]RemoteCommandMessage) (Triggers, error) {
+	t := Triggers{}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	triggers := []Trigger{}
+	err := dec.Decode(&triggers)
+	if err != nil {
+		return t, fmt.Errorf("error decoding triggers JSON: %v", err)
+	}
+
+	for _, trigger := range triggers {
+		if len(trigger.Sensor) == 0 {
+			return t, fmt.Errorf("trigger for macro %v does not specify a sensor", trigger.Macro)
+		}
+		state, err := broadlinkrm.ParseAlarmSensorState(trigger.State)
+		if err != nil {
+			return t, fmt.Errorf("invalid trigger for sensor %v: %v", trigger.Sensor, err)
+		}
+		msg, ok := macros[trigger.Macro]
+		if !ok {
+			return t, fmt.Errorf("trigger for sensor %v refers to %v, which is not a valid macro", trigger.Sensor, trigger.Macro)
+		}
+		t.triggers = append(t.triggers, compiledTrigger{
+			sensor: trigger.Sensor,
+			state:  state,
+			macro:  trigger.Macro,
+			msg:    msg,
+		})
+	}
+
+	return t, nil
+}
+
+// Count returns the number of triggers.
+func (t Triggers) Count() int {
+	return len(t.triggers)
+}
+
+// TriggerWorker watches events for alarm sensor changes and queues the macros
+// of the matching triggers on the channel. It returns when events is closed.
+func TriggerWorker(events <-chan broadlinkrm.Event, triggers Triggers, ch chan RemoteCommandMessage) {
+	for e := range events {
+		if e.Type != broadlinkrm.AlarmSensorChanged {
+			continue
+		}
+		for _, t := range triggers.triggers {
+			if t.state != e.Sensor.State {
+				continue
+			}
+			if !strings.EqualFold(t.sensor, e.Sensor.Name) && !strings.EqualFold(t.sensor, e.Sensor.Serial) {
+				continue
+			}
+			log.Printf("Sensor %v is %v - executing macro %v", e.Sensor.Name, e.Sensor.State, t.macro)
+			ch <- t.msg
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package broadlinkrm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The S1 hub reports its paired sensors in 83-byte records: the status, the
+// sensor's position, an unused byte, the sensor type, a zero-padded name and a
+// 4-byte serial number. Based on the S1C class in
+// https://github.com/mjg59/python-broadlink
+
+const alarmSensorRecordSize = 83
+
+// AlarmSensorType identifies a sensor paired with an S1 hub.
+type AlarmSensorType int
+
+// Enumerations of AlarmSensorType.
+const (
+	AlarmMotionSensor AlarmSensorType = 0x21
+	AlarmDoorSensor   AlarmSensorType = 0x31
+	AlarmKeyFob       AlarmSensorType = 0x91
+)
+
+func (t AlarmSensorType) String() string {
+	switch t {
+	case AlarmMotionSensor:
+		return "motion sensor"
+	case AlarmDoorSensor:
+		return "door sensor"
+	case AlarmKeyFob:
+		return "key fob"
+	}
+	return "unknown"
+}
+
+// AlarmSensorState is the state of a sensor paired with an S1 hub.
+type AlarmSensorState int
+
+// Enumerations of AlarmSensorState.
+const (
+	AlarmStateUnknown AlarmSensorState = iota
+	AlarmClosed
+	AlarmOpen
+	AlarmNoMotion
+	AlarmMotion
+	AlarmTampered
+	AlarmDisarmed
+	AlarmArmedAway
+	AlarmArmedHome
+	AlarmSOS
+)
+
+func (s AlarmSensorState) String() string {
+	switch s {
+	case AlarmClosed:
+		return "closed"
+	case AlarmOpen:
+		return "open"
+	case AlarmNoMotion:
+		return "no motion"
+	case AlarmMotion:
+		return "motion"
+	case AlarmTampered:
+		return "tampered"
+	case AlarmDisarmed:
+		return "disarmed"
+	case AlarmArmedAway:
+		return "armed away"
+	case AlarmArmedHome:
+		return "armed home"
+	case AlarmSOS:
+		return "sos"
+	}
+	return "unknown"
+}
+
+// ParseAlarmSensorState is the inverse of AlarmSensorState.String.
+func ParseAlarmSensorState(s string) (AlarmSensorState, error) {
+	for state := AlarmClosed; state <= AlarmSOS; state++ {
+		if strings.EqualFold(s, state.String()) {
+			return state, nil
+		}
+	}
+	return AlarmStateUnknown, fmt.Errorf("%v is not a valid alarm sensor state", s)
+}
+
+// AlarmSensor describes a sensor paired with an S1 hub.
+type AlarmSensor struct {
+	Order  int // position of the sensor in the hub's list
+	Type   AlarmSensorType
+	Name   string
+	Serial string // hex-encoded serial number
+	Status int    // raw status byte
+	State  AlarmSensorState
+}
+
+// GetAlarmSensors returns the sensors paired with an S1 hub along with their
+// current state. If id is an empty string it selects the first device.
+func (b *Broadlink) GetAlarmSensors(id string) ([]AlarmSensor, error) {
+	return b.GetAlarmSensorsContext(context.Background(), id)
+}
+
+// GetAlarmSensorsContext is like GetAlarmSensors but gives up as soon as ctx
+// is done.
+func (b *Broadlink) GetAlarmSensorsContext(ctx context.Context, id string) ([]AlarmSensor, error) {
+	d, err := b.deviceExistsAndIsKnown(id)
+	if err != nil {
+		return nil, err
+	}
+	if d.family() != familyS1 {
+		return nil, unsupportedf("device %v is of device type %v (0x%04x) and is not an S1 alarm hub", d.mac.String(), d.deviceType, d.deviceType)
+	}
+	if err := d.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer d.release()
+
+	return d.getAlarmSensors(ctx)
+}
+
+// StartAlarmMonitor polls every S1 hub at each interval until ctx is done, and
+// publishes an AlarmSensorChanged event whenever the state of one of its
+// sensors changes. The first poll only records the states.
+func (b *Broadlink) StartAlarmMonitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		states := make(map[string]AlarmSensorState)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				b.pollAlarmSensors(ctx, states)
+			}
+		}
+	}()
+}
+
+// pollAlarmSensors reads the sensors of each S1 hub and compares them with
+// states, which is keyed by the MAC address of the hub and the serial number
+// of the sensor.
+func (b *Broadlink) pollAlarmSensors(ctx context.Context, states map[string]AlarmSensorState) {
+	b.mu.RLock()
+	devices := make([]*device, 0, len(b.devices))
+	for _, d := range b.devices {
+		if d.family() == familyS1 {
+			devices = append(devices, d)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, d := range devices {
+		if err := d.acquire(ctx); err != nil {
+			return
+		}
+		sensors, err := d.getAlarmSensors(ctx)
+		d.release()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Could not poll sensors of device %v: %v", d.mac.String(), err)
+			}
+			continue
+		}
+
+		for _, s := range sensors {
+			key := d.mac.String() + "/" + s.Serial
+			previous, seen := states[key]
+			states[key] = s.State
+			if !seen || previous == s.State {
+				continue
+			}
+			log.Printf("Sensor %v (%v) of device %v changed from %v to %v", s.Name, s.Serial, d.mac.String(), previous, s.State)
+			b.publish(Event{
+				Type:          AlarmSensorChanged,
+				MAC:           d.mac.String(),
+				IP:            d.address(),
+				Sensor:        s,
+				PreviousState: previous,
+			})
+		}
+	}
+}
+
+func (d *device) getAlarmSensors(ctx context.Context) ([]AlarmSensor, error) {
+	resp, err := d.serverRequest(ctx, getAlarmSensorsPayload())
+	if err != nil {
+		return nil, fmt.Errorf("error while making server request to read alarm sensors: %w", err)
+	}
+	if resp.Type == DeviceError {
+		return nil, resp.deviceError()
+	}
+	if resp.Type != CommandOK || len(resp.Data) < 2 {
+		return nil, fmt.Errorf("expected response type %v but got %v instead", CommandOK, resp.Type)
+	}
+
+	// The number of sensors is followed by a 2-byte gap and the records.
+	count := int(resp.Data[0])
+	records := resp.Data[2:]
+	sensors := []AlarmSensor{}
+	for i := 0; i < count && (i+1)*alarmSensorRecordSize <= len(records); i++ {
+		r := records[i*alarmSensorRecordSize : (i+1)*alarmSensorRecordSize]
+		serial := r[26:30]
+		if serial[0]|serial[1]|serial[2]|serial[3] == 0 {
+			// unused slot
+			continue
+		}
+		s := AlarmSensor{
+			Order:  int(r[1]),
+			Type:   AlarmSensorType(r[3]),
+			Name:   strings.TrimRight(string(r[4:26]), "\x00"),
+			Serial: hex.EncodeToString(serial),
+			Status: int(r[0]),
+		}
+		s.State = alarmSensorState(s.Type, r[0])
+		sensors = append(sensors, s)
+	}
+	return sensors, nil
+}
+
+// alarmSensorState interprets a status byte. The top bit is set by some
+// sensors and does not change the meaning of the rest.
+func alarmSensorState(t AlarmSensorType, status byte) AlarmSensorState {
+	status &= 0x7f
+	switch t {
+	case AlarmDoorSensor:
+		switch status {
+		case 0x00:
+			return AlarmClosed
+		case 0x10:
+			return AlarmOpen
+		case 0x30:
+			return AlarmTampered
+		}
+	case AlarmMotionSensor:
+		switch status {
+		case 0x00:
+			return AlarmNoMotion
+		case 0x10:
+			return AlarmMotion
+		case 0x20:
+			return AlarmTampered
+		}
+	case AlarmKeyFob:
+		switch status {
+		case 0x00:
+			return AlarmSOS
+		case 0x10:
+			return AlarmDisarmed
+		case 0x20:
+			return AlarmArmedAway
+		case 0x40:
+			return AlarmArmedHome
+		}
+	}
+	return AlarmStateUnknown
+}
+
+func getAlarmSensorsPayload() unencryptedRequest {
+	return unencryptedRequest{
+		command: 0x6a,
+		payload: basicRequestPayload(0x06),
+	}
+}
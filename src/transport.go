@@ -0,0 +1,48 @@
+package broadlinkrm
+
+import (
+	"net"
+	"strconv"
+)
+
+const defaultDevicePort = 80
+
+// Transport creates the sockets used to talk to devices. Implement this to
+// point the library at an emulator on a custom port, to go through a relay, or
+// to run entirely in-memory.
+type Transport interface {
+	// ListenPacket returns a new, unconnected packet socket. It is used for
+	// discovery as well as for all requests sent to a device.
+	ListenPacket() (net.PacketConn, error)
+
+	// Port returns the UDP port that devices listen on.
+	Port() int
+}
+
+// UDPTransport is the default Transport. It binds to an ephemeral UDP port and
+// sends to port 80 on the device.
+type UDPTransport struct {
+	// LocalAddr is the local address to bind to. It defaults to an ephemeral
+	// port on all interfaces.
+	LocalAddr string
+
+	// DevicePort is the UDP port that devices listen on. It defaults to 80.
+	DevicePort int
+}
+
+// ListenPacket binds a new IPv4 UDP socket.
+func (t UDPTransport) ListenPacket() (net.PacketConn, error) {
+	return net.ListenPacket("udp4", t.LocalAddr)
+}
+
+// Port returns the UDP port that devices listen on.
+func (t UDPTransport) Port() int {
+	if t.DevicePort <= 0 {
+		return defaultDevicePort
+	}
+	return t.DevicePort
+}
+
+func deviceAddress(t Transport, ip string) string {
+	return net.JoinHostPort(ip, strconv.Itoa(t.Port()))
+}